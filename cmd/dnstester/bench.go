@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"dnstester/internal/bench"
+	"dnstester/internal/config"
+	"dnstester/internal/report"
+	"dnstester/pkg/types"
+)
+
+// runBenchCommand implements "dnstester bench": it benchmarks one configured server and writes the
+// benchmark report.
+func runBenchCommand(args []string) int {
+	var opts reportFlags
+	var benchOptions benchFlags
+	flags := newFlagSet("bench", "")
+	opts.register(flags, "text or json")
+	flags.StringVar(&benchOptions.server, "server", "", "Server name to benchmark (default: the only configured server)")
+	flags.StringVar(&benchOptions.server, "bench-server", "", "Deprecated: use -server")
+	flags.StringVar(&benchOptions.protocol, "protocol", "", "Protocol to benchmark (default: the server's first protocol)")
+	flags.IntVar(&benchOptions.clients, "clients", bench.DefaultClients, "Concurrent benchmark clients, each with its own connection")
+	flags.Float64Var(&benchOptions.qps, "qps", 0, "Target benchmark query rate (default: unlimited)")
+	flags.DurationVar(&benchOptions.duration, "duration", bench.DefaultDuration, "Benchmark duration")
+	legacyFlag(flags, "bench")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if opts.format != report.FormatText && opts.format != report.FormatJSON {
+		return usageError(flags, fmt.Errorf("invalid format '%s' (valid formats: %s, %s)", opts.format, report.FormatText, report.FormatJSON))
+	}
+
+	cfg, err := config.LoadConfig(opts.configFile)
+	if err != nil {
+		return failf(exitConfigError, "Failed to load config: %v", err)
+	}
+	if err := runBench(cfg, benchOptions, opts.outputFile, opts.format); err != nil {
+		return failf(exitError, "Benchmark failed: %v", err)
+	}
+	return exitOK
+}
+
+// benchFlags holds the command line options of the bench command.
+type benchFlags struct {
+	server   string
+	protocol string
+	clients  int
+	qps      float64
+	duration time.Duration
+}
+
+// runBench benchmarks one configured server over one protocol with the configured domains and writes
+// the benchmark report.
+func runBench(cfg *types.Config, flags benchFlags, outputFile string, format string) error {
+	server, err := benchServer(cfg.Servers, flags.server)
+	if err != nil {
+		return err
+	}
+
+	protocol := strings.ToLower(flags.protocol)
+	if protocol == "" {
+		protocol = strings.ToLower(server.Protocols[0])
+	}
+
+	progress := os.Stdout
+	if outputFile == "" && format != report.FormatText {
+		progress = os.Stderr
+	}
+	rate := "as fast as possible"
+	if flags.qps > 0 {
+		rate = fmt.Sprintf("at %.0f QPS", flags.qps)
+	}
+	duration := flags.duration
+	if duration <= 0 {
+		duration = bench.DefaultDuration
+	}
+	fmt.Fprintf(progress, "Benchmarking %s via %s for %s %s...\n\n", server.Name, protocol, duration, rate)
+
+	result, err := bench.Run(context.Background(), bench.Options{
+		Server:     server,
+		Protocol:   protocol,
+		Domains:    cfg.Domains,
+		QueryTypes: cfg.QueryTypes,
+		Clients:    flags.clients,
+		QPS:        flags.qps,
+		Duration:   duration,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := report.GenerateBenchReport(result, outputFile, format); err != nil {
+		return err
+	}
+	if outputFile != "" {
+		fmt.Fprintf(progress, "Report saved to: %s\n", outputFile)
+	}
+	return nil
+}
+
+// benchServer returns the configured server with the given name, or the only server when name is empty.
+func benchServer(servers []types.Server, name string) (types.Server, error) {
+	if name == "" {
+		if len(servers) != 1 {
+			return types.Server{}, fmt.Errorf("the config has %d servers; select one with -server", len(servers))
+		}
+		return servers[0], nil
+	}
+	for _, server := range servers {
+		if server.Name == name {
+			return server, nil
+		}
+	}
+	return types.Server{}, fmt.Errorf("server '%s' not found in config", name)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"dnstester/internal/report"
+)
+
+// Exit codes of the compare command, following diff(1)
+const (
+	compareExitRegressions = 1
+	compareExitError       = 2
+)
+
+// runCompare implements "dnstester compare [options] baseline.json current.json" and returns the exit
+// code: 0 without regressions, 1 with regressions and 2 on errors.
+func runCompare(args []string) int {
+	flags := newFlagSet("compare", " baseline.json current.json")
+	outputFile := flags.String("output", "", "Path to output report file (default: stdout)")
+	format := flags.String("format", report.FormatText, "Report format: text or json")
+	threshold := flags.Float64("latency-threshold", report.DefaultLatencyThreshold*100, "Response time increase, in percent, that counts as a latency regression")
+	minDelta := flags.Duration("latency-min-delta", time.Duration(report.DefaultLatencyMinDelta*float64(time.Millisecond)), "Minimum response time increase that counts as a latency regression")
+	answers := flags.Bool("fail-on-answer-change", false, "Count changed answer sets as regressions")
+	if err := flags.Parse(args); err != nil {
+		// Help requests succeed as with every command; other errors keep diff's exit code
+		if code := flagError(err); code == exitOK {
+			return code
+		}
+		return compareExitError
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return compareExitError
+	}
+
+	baseline, err := report.LoadReport(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return compareExitError
+	}
+	current, err := report.LoadReport(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return compareExitError
+	}
+
+	comparison := report.Compare(baseline, current, report.CompareOptions{
+		LatencyThreshold: *threshold / 100,
+		LatencyMinDelta:  float64(minDelta.Microseconds()) / 1000,
+		AnswersRegress:   *answers,
+	})
+	comparison.Baseline = flags.Arg(0)
+	comparison.Current = flags.Arg(1)
+
+	if err := report.GenerateComparisonReport(comparison, *outputFile, *format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return compareExitError
+	}
+	if comparison.Regressions > 0 {
+		return compareExitRegressions
+	}
+	return 0
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+
+	"dnstester/internal/policy"
+)
+
+// Exit codes of the commands. compare exits like diff(1) instead; monitor, bench and serve exit with
+// exitError when they fail.
+const (
+	exitOK                = 0
+	exitQueryFailures     = 1 // queries failed under the failure policy
+	exitAssertionFailures = 2 // every failure that failed the run was an unmet expectation
+	exitConfigError       = 3 // invalid configuration file or command line
+	exitError             = 4 // any other error, e.g. the report could not be written
+)
+
+// failf logs a message and returns code, for commands to return as their exit code.
+func failf(code int, format string, args ...any) int {
+	log.Printf(format, args...)
+	return code
+}
+
+// outcomeExitCode returns the exit code of a run with the failure policy's outcome: query failures
+// take precedence over unmet expectations.
+func outcomeExitCode(outcome policy.Outcome) int {
+	switch {
+	case !outcome.Failed:
+		return exitOK
+	case outcome.QueryFailures > 0:
+		return exitQueryFailures
+	default:
+		return exitAssertionFailures
+	}
+}
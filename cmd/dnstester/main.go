@@ -3,95 +3,133 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"strings"
 
-	"dnstester/internal/config"
-	"dnstester/internal/dns"
 	"dnstester/internal/report"
-	"dnstester/internal/server"
-	"dnstester/pkg/types"
 )
 
-func main() {
-	var configFile string
-	var outputFile string
-	var csvOutput bool
-	var serverMode bool
-	var serverAddr string
+// command is a dnstester subcommand. run parses the command's arguments and returns the exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
 
-	flag.StringVar(&configFile, "config", "config.yaml", "Path to YAML configuration file")
-	flag.StringVar(&outputFile, "output", "", "Path to output report file (default: stdout)")
-	flag.BoolVar(&csvOutput, "csv", false, "Output report in CSV format")
-	flag.BoolVar(&serverMode, "server", false, "Run in server mode (HTTP WebUI)")
-	flag.StringVar(&serverAddr, "addr", ":8080", "Server address (default: :8080)")
-	flag.Parse()
+var commands = []command{
+	{"run", "Run the configured tests and write a report", runTests},
+	{"serve", "Start the HTTP server with the WebUI and API", runServe},
+	{"query", "Send a single query and print the response, like dig", runQuery},
+	{"validate", "Check a configuration file", runValidate},
+	{"bench", "Benchmark one server over one protocol", runBenchCommand},
+	{"monitor", "Run the configured tests on a schedule until interrupted", runMonitorCommand},
+	{"compare", "Compare two JSON reports and list regressions", runCompare},
+}
 
-	// If server mode, start HTTP server
-	if serverMode {
-		log.Printf("Starting DNS Tester server on %s", serverAddr)
-		if err := server.StartServer(serverAddr); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			usage(os.Stdout)
+			os.Exit(exitOK)
 		}
-		return
 	}
 
-	// Original CLI mode
-	if configFile == "" {
-		fmt.Fprintf(os.Stderr, "Error: config file is required\n")
-		flag.Usage()
-		os.Exit(1)
+	// Invocations that start with a flag predate the subcommands: pick the command from the old mode flags
+	name := legacyCommand(args)
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-
-	cfg, err := config.LoadConfig(configFile)
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			os.Exit(cmd.run(args))
+		}
 	}
+	fmt.Fprintf(os.Stderr, "Error: unknown command '%s'\n\n", name)
+	usage(os.Stderr)
+	os.Exit(exitConfigError)
+}
 
-	var results []types.QueryResult
-
-	fmt.Println("Starting DNS tests...")
-	fmt.Printf("Testing %d domain(s) against %d server(s)...\n\n", len(cfg.Domains), len(cfg.Servers))
-
-	for _, server := range cfg.Servers {
-		fmt.Printf("Testing server: %s (%s)\n", server.Name, server.Address)
-
-		for _, domain := range cfg.Domains {
-			for _, protocol := range server.Protocols {
-				fmt.Printf("  Querying %s via %s...\n", domain, protocol)
-				result := dns.QueryDNS(server, domain, protocol)
-				results = append(results, result)
+// usage lists the commands.
+func usage(w *os.File) {
+	fmt.Fprintf(w, "Usage: dnstester <command> [options]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun 'dnstester <command> -h' for the options of a command.\n")
+}
 
-				if result.Success {
-					fmt.Printf("    ✓ Success: %s (Time: %d ms)\n",
-						formatIPs(result.ResponseIPs), result.ResponseTime)
-				} else {
-					fmt.Printf("    ✗ Failed: %s\n", result.Error)
-				}
+// legacyCommand returns the command selected by the mode flags of the flag-only command line:
+// -server, -bench and -monitor (serve takes -monitor as an option), or run without any.
+func legacyCommand(args []string) string {
+	isSet := func(name string) bool {
+		for _, arg := range args {
+			if arg == "--" {
+				break
+			}
+			if !strings.HasPrefix(arg, "-") {
+				continue
+			}
+			arg = strings.TrimLeft(arg, "-")
+			if arg == name || arg == name+"=true" {
+				return true
 			}
 		}
-		fmt.Println()
+		return false
 	}
-
-	// Generate report
-	fmt.Println("Generating report...")
-	if err := report.GenerateReport(results, outputFile, csvOutput); err != nil {
-		log.Fatalf("Failed to generate report: %v", err)
+	switch {
+	case isSet("server"):
+		return "serve"
+	case isSet("bench"):
+		return "bench"
+	case isSet("monitor"):
+		return "monitor"
 	}
+	return "run"
+}
 
-	if outputFile != "" {
-		fmt.Printf("\nReport saved to: %s\n", outputFile)
+// newFlagSet returns the flag set of a command. Parse errors are returned rather than exiting with the
+// flag package's 2, which is exitAssertionFailures.
+func newFlagSet(name string, arguments string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: dnstester %s [options]%s\n\n", name, arguments)
+		flags.PrintDefaults()
 	}
+	return flags
 }
 
-// formatIPs formats a slice of IP addresses for display
-func formatIPs(ips []string) string {
-	if len(ips) == 0 {
-		return "No IPs"
-	}
-	if len(ips) == 1 {
-		return ips[0]
+// legacyFlag accepts a mode flag of the flag-only command line that is implied by the command.
+func legacyFlag(flags *flag.FlagSet, name string) {
+	flags.Bool(name, false, fmt.Sprintf("Deprecated: use 'dnstester %s'", flags.Name()))
+}
+
+// flagError returns the exit code for a flag parse error: help requests succeed.
+func flagError(err error) int {
+	if err == flag.ErrHelp {
+		return exitOK
 	}
-	return fmt.Sprintf("%d IPs: %s", len(ips), strings.Join(ips, ", "))
+	return exitConfigError
+}
+
+// usageError reports an invalid command line and returns exitConfigError.
+func usageError(flags *flag.FlagSet, err error) int {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	flags.Usage()
+	return exitConfigError
+}
+
+// reportFlags are the options of the commands that run the tests of a config file and write a report.
+type reportFlags struct {
+	configFile string
+	outputFile string
+	format     string
+}
+
+// register adds the options to flags; formats lists the report formats the command supports.
+func (f *reportFlags) register(flags *flag.FlagSet, formats string) {
+	flags.StringVar(&f.configFile, "config", "config.yaml", "Path to YAML configuration file")
+	flags.StringVar(&f.outputFile, "output", "", "Path to output report file (default: stdout)")
+	flags.StringVar(&f.format, "format", report.FormatText, "Report format: "+formats)
 }
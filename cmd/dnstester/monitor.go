@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"dnstester/internal/config"
+	"dnstester/internal/monitor"
+	"dnstester/internal/report"
+	"dnstester/pkg/types"
+)
+
+// runMonitorCommand implements "dnstester monitor": it runs the configured tests on the monitor
+// schedule until interrupted and writes the final status of every target.
+func runMonitorCommand(args []string) int {
+	var opts reportFlags
+	flags := newFlagSet("monitor", "")
+	opts.register(flags, "text or json")
+	concurrency := flags.Int("concurrency", 0, "Maximum queries in flight (default: config value or 10)")
+	legacyFlag(flags, "monitor")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if opts.format != report.FormatText && opts.format != report.FormatJSON {
+		return usageError(flags, fmt.Errorf("invalid format '%s' (valid formats: %s, %s)", opts.format, report.FormatText, report.FormatJSON))
+	}
+
+	cfg, err := config.LoadConfig(opts.configFile)
+	if err != nil {
+		return failf(exitConfigError, "Failed to load config: %v", err)
+	}
+	if *concurrency <= 0 {
+		*concurrency = cfg.Concurrency
+	}
+	if err := runMonitor(cfg, *concurrency, opts.outputFile, opts.format); err != nil {
+		return failf(exitError, "Monitor failed: %v", err)
+	}
+	return exitOK
+}
+
+// runMonitor re-runs the configured tests on the monitor schedule until interrupted, logging state
+// changes as they happen, and writes the final status of every target when it stops.
+func runMonitor(cfg *types.Config, concurrency int, outputFile string, format string) error {
+	var events *json.Encoder
+	if cfg.Monitor.EventsFile != "" {
+		file, err := os.OpenFile(cfg.Monitor.EventsFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open events file: %w", err)
+		}
+		defer file.Close()
+		events = json.NewEncoder(file)
+	}
+
+	progress := os.Stdout
+	if outputFile == "" && format != report.FormatText {
+		progress = os.Stderr
+	}
+
+	m := monitor.New(cfg, monitor.Options{
+		Concurrency: concurrency,
+		OnEvent: func(event types.MonitorEvent) {
+			line := fmt.Sprintf("%s: %s %s via %s: %s → %s", event.ServerName, event.Domain, event.QueryType,
+				event.Protocol, event.From, event.To)
+			if event.To == types.StateDown && event.Error != "" {
+				line += " (" + event.Error + ")"
+			}
+			fmt.Fprintf(progress, "%s  %s\n", event.Time.Format(time.DateTime), line)
+			if events != nil {
+				if err := events.Encode(event); err != nil {
+					log.Printf("Failed to write event: %v", err)
+				}
+			}
+		},
+		OnRound: func(server types.Server, results []types.QueryResult) {
+			passed := 0
+			for _, result := range results {
+				if result.Passed() {
+					passed++
+				}
+			}
+			fmt.Fprintf(progress, "%s  %s: %d/%d checks passed\n", time.Now().Format(time.DateTime),
+				server.Name, passed, len(results))
+		},
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(progress, "Monitoring %d domain(s) on %d server(s); press Ctrl+C to stop...\n\n", len(cfg.Domains), len(cfg.Servers))
+	m.Run(ctx)
+	fmt.Fprintln(progress)
+
+	if err := report.GenerateMonitorReport(m.Snapshot(), outputFile, format); err != nil {
+		return err
+	}
+	if outputFile != "" {
+		fmt.Fprintf(progress, "Report saved to: %s\n", outputFile)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"dnstester/internal/dns"
+	"dnstester/pkg/types"
+
+	mdns "github.com/miekg/dns"
+)
+
+// runQuery implements "dnstester query [options] [@server] name [type]": it sends one query over any
+// supported protocol and prints the response in dig's format, with the timing of each phase. Options
+// may follow the arguments, as with dig. It exits with exitQueryFailures unless the rcode is NOERROR.
+func runQuery(args []string) int {
+	flags := newFlagSet("query", " [@server] name [type]")
+	protocol := flags.String("p", "udp", "Protocol: "+strings.Join(dns.Protocols(), ", "))
+	flags.StringVar(protocol, "protocol", "udp", "Same as -p")
+	timeout := flags.Duration("timeout", dns.DefaultTimeout, "Timeout per attempt")
+	retries := flags.Int("retries", 0, "Additional attempts after a transport error")
+	do := flags.Bool("dnssec", false, "Set the DNSSEC OK (DO) bit")
+	cd := flags.Bool("cd", false, "Set the Checking Disabled (CD) bit")
+	validate := flags.Bool("validate", false, "Validate the response locally up to the root trust anchors (implies -dnssec)")
+	udpSize := flags.Uint("bufsize", 0, "Advertised EDNS UDP payload size (default: 4096 when EDNS is used)")
+	subnet := flags.String("subnet", "", "Send an EDNS Client Subnet prefix, e.g. 198.51.100.0/24")
+	cookie := flags.Bool("cookie", false, "Send a DNS cookie and verify the server cookie")
+	nsid := flags.Bool("nsid", false, "Request the name server identifier")
+	padding := flags.Bool("padding", false, "Pad the query and check that dot, doh and doq responses are padded")
+	identify := flags.Bool("identify", false, "Identify the server instance from the NSID, or an id.server or hostname.bind CHAOS query")
+	tlsServerName := flags.String("tls-server-name", "", "TLS server name for dot, doq and doh (default: the server host)")
+	insecure := flags.Bool("insecure", false, "Do not verify the server's TLS certificate")
+	short := flags.Bool("short", false, "Print only the answer data")
+	jsonOutput := flags.Bool("json", false, "Print the result as JSON, as in json reports")
+
+	// Parse options and arguments in any order
+	commandLine := strings.Join(args, " ")
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return flagError(err)
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	var address, name, queryType string
+	for _, arg := range positional {
+		switch {
+		case strings.HasPrefix(arg, "@"):
+			address = arg[1:]
+		case strings.EqualFold(arg, "IN"):
+			// The only class supported
+		case queryType == "" && isQueryType(arg):
+			queryType = strings.ToUpper(arg)
+		case name == "":
+			name = arg
+		default:
+			return usageError(flags, fmt.Errorf("unexpected argument '%s'", arg))
+		}
+	}
+	if name == "" {
+		return usageError(flags, fmt.Errorf("a name to query is required"))
+	}
+	if queryType == "" {
+		queryType = "A"
+	}
+	*protocol = strings.ToLower(*protocol)
+	if _, ok := dns.LookupTransport(*protocol); !ok {
+		return usageError(flags, fmt.Errorf("unsupported protocol '%s' (supported: %s)", *protocol, strings.Join(dns.Protocols(), ", ")))
+	}
+	if address == "" {
+		var err error
+		if address, err = systemNameserver(); err != nil {
+			return usageError(flags, fmt.Errorf("no @server given and %v", err))
+		}
+	}
+
+	server := types.Server{
+		Name:                  address,
+		Address:               address,
+		Protocols:             []string{*protocol},
+		Timeout:               types.Duration(*timeout),
+		Retries:               retries,
+		TLSServerName:         *tlsServerName,
+		TLSInsecureSkipVerify: *insecure,
+		Identify:              *identify,
+	}
+	if *do || *cd || *validate {
+		server.DNSSEC = &types.DNSSECOptions{DO: *do, CD: *cd, Validate: *validate}
+	}
+	if *udpSize > 0 || *subnet != "" || *cookie || *nsid || *padding {
+		if *udpSize > 0 && *udpSize < 512 || *udpSize > 65535 {
+			return usageError(flags, fmt.Errorf("-bufsize must be between 512 and 65535"))
+		}
+		if *subnet != "" {
+			if _, err := dns.ParseClientSubnet(*subnet); err != nil {
+				return usageError(flags, err)
+			}
+		}
+		server.EDNS = &types.EDNSOptions{
+			UDPSize:      uint16(*udpSize),
+			ClientSubnet: *subnet,
+			Cookie:       *cookie,
+			NSID:         *nsid,
+			Padding:      *padding,
+		}
+	}
+
+	result, response := dns.QueryMessage(context.Background(), server, name, *protocol, queryType)
+
+	switch {
+	case *jsonOutput:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			return failf(exitError, "Failed to write result: %v", err)
+		}
+	case *short:
+		for _, answer := range result.Answers {
+			fmt.Println(strings.TrimSpace(answer.Data))
+		}
+		if response == nil {
+			fmt.Fprintf(os.Stderr, ";; %s\n", result.Error)
+		}
+	default:
+		fmt.Printf("; <<>> dnstester <<>> %s\n", commandLine)
+		if response != nil {
+			printResponse(os.Stdout, response)
+		} else if len(result.AttemptErrors) > 1 {
+			// The footer shows the error of the last attempt
+			for i, err := range result.AttemptErrors[:len(result.AttemptErrors)-1] {
+				fmt.Printf(";; attempt %d: %s\n", i+1, err)
+			}
+		}
+		printQueryFooter(os.Stdout, result, response)
+	}
+
+	if !result.Success {
+		return exitQueryFailures
+	}
+	return exitOK
+}
+
+// isQueryType reports whether arg names a record type.
+func isQueryType(arg string) bool {
+	_, err := dns.ParseQueryType(arg)
+	return err == nil
+}
+
+// systemNameserver returns the first nameserver in /etc/resolv.conf.
+func systemNameserver() (string, error) {
+	config, err := mdns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return "", fmt.Errorf("failed to read the system resolver: %w", err)
+	}
+	if len(config.Servers) == 0 {
+		return "", fmt.Errorf("the system resolver has no nameservers")
+	}
+	return config.Servers[0], nil
+}
+
+// printResponse prints the header and sections of a response as dig does.
+func printResponse(w io.Writer, r *mdns.Msg) {
+	var additional []mdns.RR
+	for _, rr := range r.Extra {
+		if rr.Header().Rrtype != mdns.TypeOPT {
+			additional = append(additional, rr)
+		}
+	}
+
+	fmt.Fprintf(w, ";; Got answer:\n")
+	fmt.Fprintf(w, ";; ->>HEADER<<- %s QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n",
+		strings.TrimPrefix(r.MsgHdr.String(), ";; "), len(r.Question), len(r.Answer), len(r.Ns), len(r.Extra))
+	if opt := r.IsEdns0(); opt != nil {
+		fmt.Fprintln(w, opt.String())
+	}
+
+	fmt.Fprintf(w, "\n;; QUESTION SECTION:\n")
+	for _, question := range r.Question {
+		fmt.Fprintln(w, question.String())
+	}
+	printSection(w, "ANSWER", r.Answer)
+	printSection(w, "AUTHORITY", r.Ns)
+	printSection(w, "ADDITIONAL", additional)
+}
+
+// printSection prints the records of a non-empty response section.
+func printSection(w io.Writer, name string, rrs []mdns.RR) {
+	if len(rrs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n;; %s SECTION:\n", name)
+	for _, rr := range rrs {
+		fmt.Fprintln(w, rr.String())
+	}
+}
+
+// printQueryFooter prints any error, DNSSEC validation outcome, EDNS checks and server instance, then the statistics
+// dig ends with: the query time, here with its phases, the server, the time and the response size.
+func printQueryFooter(w io.Writer, result types.QueryResult, r *mdns.Msg) {
+	fmt.Fprintln(w)
+	if r == nil {
+		fmt.Fprintf(w, ";; %s\n", result.Error)
+	}
+	if result.DNSSECStatus != "" {
+		status := result.DNSSECStatus
+		if result.DNSSECReason != "" {
+			status += " (" + result.DNSSECReason + ")"
+		}
+		fmt.Fprintf(w, ";; DNSSEC: %s\n", status)
+	}
+	if result.CookieStatus != "" {
+		fmt.Fprintf(w, ";; COOKIE: %s\n", result.CookieStatus)
+	}
+	if result.PaddingStatus != "" {
+		fmt.Fprintf(w, ";; PADDING: %s\n", result.PaddingStatus)
+	}
+	if result.Instance != "" {
+		fmt.Fprintf(w, ";; INSTANCE: %s (%s)\n", result.Instance, result.InstanceSource)
+	} else if result.InstanceSource != "" {
+		fmt.Fprintf(w, ";; INSTANCE: unidentified\n")
+	}
+
+	timing := fmt.Sprintf("%.3f ms", result.ResponseTime)
+	var phases []string
+	for _, phase := range []struct {
+		name string
+		ms   float64
+	}{
+		{"lookup", result.Timing.DNSLookup},
+		{"connect", result.Timing.Connect},
+		{"tls", result.Timing.TLSHandshake},
+		{"http", result.Timing.HTTP},
+		{"exchange", result.Timing.Exchange},
+	} {
+		if phase.ms > 0 {
+			phases = append(phases, fmt.Sprintf("%s %.3f ms", phase.name, phase.ms))
+		}
+	}
+	if len(phases) > 0 {
+		timing += " (" + strings.Join(phases, ", ") + ")"
+	}
+	if result.Retried() {
+		timing += fmt.Sprintf(", after %d attempts", result.Attempts)
+	}
+	fmt.Fprintf(w, ";; Query time: %s\n", timing)
+
+	protocol := result.Protocol
+	if result.HTTPVersion != "" {
+		protocol += ", " + result.HTTPVersion
+	}
+	fmt.Fprintf(w, ";; SERVER: %s (%s)\n", result.ServerAddress, protocol)
+	fmt.Fprintf(w, ";; WHEN: %s\n", time.Now().Format(time.UnixDate))
+	if r != nil {
+		fmt.Fprintf(w, ";; MSG SIZE  rcvd: %d\n", result.ResponseSize)
+	}
+}
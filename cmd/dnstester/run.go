@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"dnstester/internal/config"
+	"dnstester/internal/policy"
+	"dnstester/internal/report"
+	"dnstester/internal/runner"
+	"dnstester/pkg/types"
+)
+
+// runTests implements "dnstester run": it queries every configured domain on every server and
+// protocol, writes the report and returns the exit code the failure policy gives the results.
+func runTests(args []string) int {
+	var opts reportFlags
+	flags := newFlagSet("run", "")
+	opts.register(flags, "text, csv, json, ndjson or junit")
+	csvOutput := flags.Bool("csv", false, "Output report in CSV format (deprecated: use -format csv)")
+	concurrency := flags.Int("concurrency", 0, "Maximum queries in flight (default: config value or 10)")
+	reference := flags.String("reference", "", "Server name to compare answers against (default: config value or majority)")
+	failOn := flags.String("fail-on", policy.Any, "When failed queries fail the run: any, all-servers-down or threshold=N%")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+
+	if opts.configFile == "" {
+		return usageError(flags, fmt.Errorf("config file is required"))
+	}
+	if *csvOutput {
+		opts.format = report.FormatCSV
+	}
+	if err := report.ValidateFormat(opts.format); err != nil {
+		return usageError(flags, err)
+	}
+	failPolicy, err := policy.Parse(*failOn)
+	if err != nil {
+		return usageError(flags, err)
+	}
+
+	cfg, err := config.LoadConfig(opts.configFile)
+	if err != nil {
+		return failf(exitConfigError, "Failed to load config: %v", err)
+	}
+	if *reference != "" {
+		cfg.Consistency.Reference = *reference
+		if err := config.ValidateConsistency(cfg); err != nil {
+			return failf(exitConfigError, "Invalid -reference: %v", err)
+		}
+	}
+	if *concurrency <= 0 {
+		*concurrency = cfg.Concurrency
+	}
+
+	jobs := runner.Plan(cfg)
+
+	// Progress goes to stderr when a machine-readable report is written to stdout
+	progress := os.Stdout
+	if opts.outputFile == "" && opts.format != report.FormatText && opts.format != report.FormatCSV {
+		progress = os.Stderr
+	}
+
+	// NDJSON is streamed as queries complete rather than written at the end
+	var stream *report.NDJSONWriter
+	var streamErr error
+	if opts.format == report.FormatNDJSON {
+		stream, err = report.NewNDJSONWriter(opts.outputFile)
+		if err != nil {
+			return failf(exitError, "Failed to generate report: %v", err)
+		}
+	}
+
+	fmt.Fprintln(progress, "Starting DNS tests...")
+	fmt.Fprintf(progress, "Testing %d domain(s) against %d server(s) (%d queries)...\n\n", len(cfg.Domains), len(cfg.Servers), len(jobs))
+
+	results := runner.Run(context.Background(), jobs, runner.Options{
+		Concurrency: *concurrency,
+		OnResult: func(job runner.Job, result types.QueryResult) {
+			if stream != nil && streamErr == nil {
+				streamErr = stream.Write(result)
+			}
+			if result.Retried() {
+				fmt.Fprintf(progress, "  ✓ %s: %s %s via %s: %s (Time: %.3f ms, after %d attempts)\n",
+					job.Server.Name, job.Domain.Name, result.QueryType, job.Protocol,
+					formatAnswers(result.Answers), result.ResponseTime, result.Attempts)
+			} else if result.Success {
+				fmt.Fprintf(progress, "  ✓ %s: %s %s via %s: %s (Time: %.3f ms)\n",
+					job.Server.Name, job.Domain.Name, result.QueryType, job.Protocol,
+					formatAnswers(result.Answers), result.ResponseTime)
+			} else {
+				reason := result.Error
+				for _, ede := range result.ExtendedErrors {
+					reason += "; " + ede.String()
+				}
+				fmt.Fprintf(progress, "  ✗ %s: %s %s via %s failed: %s\n",
+					job.Server.Name, job.Domain.Name, result.QueryType, job.Protocol, reason)
+			}
+			if result.Assertion != nil && !result.Assertion.Passed {
+				fmt.Fprintf(progress, "    ✗ Assertion failed: %s\n", strings.Join(result.Assertion.Failures, "; "))
+			}
+		},
+	})
+	fmt.Fprintln(progress)
+
+	if stream != nil {
+		if err := stream.Close(); streamErr == nil {
+			streamErr = err
+		}
+		if streamErr != nil {
+			return failf(exitError, "Failed to generate report: %v", streamErr)
+		}
+	} else {
+		// Generate report
+		fmt.Fprintln(progress, "Generating report...")
+		if err := report.GenerateReport(results, opts.outputFile, opts.format, cfg.Consistency.Reference); err != nil {
+			return failf(exitError, "Failed to generate report: %v", err)
+		}
+	}
+
+	if opts.outputFile != "" {
+		fmt.Fprintf(progress, "\nReport saved to: %s\n", opts.outputFile)
+	}
+
+	outcome := failPolicy.Evaluate(cfg.Servers, results)
+	if outcome.Failed {
+		fmt.Fprintf(os.Stderr, "\nFAILED: %s\n", outcome.Reason)
+	}
+	return outcomeExitCode(outcome)
+}
+
+// formatAnswers formats a slice of answer records for display
+func formatAnswers(answers []types.Answer) string {
+	if len(answers) == 0 {
+		return "No answers"
+	}
+	if len(answers) == 1 {
+		return report.FormatAnswer(answers[0])
+	}
+	return fmt.Sprintf("%d answers: %s", len(answers), report.FormatAnswers(answers, ", "))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mdns "github.com/miekg/dns"
+)
+
+// serveTestZone answers ok.test with an address, nx.test with NXDOMAIN and anything else with
+// SERVFAIL, on a local UDP port until the test ends. It returns the address.
+func serveTestZone(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	handler := mdns.HandlerFunc(func(w mdns.ResponseWriter, r *mdns.Msg) {
+		m := new(mdns.Msg)
+		m.SetReply(r)
+		switch r.Question[0].Name {
+		case "ok.test.":
+			rr, _ := mdns.NewRR("ok.test. 60 IN A 192.0.2.1")
+			m.Answer = append(m.Answer, rr)
+		case "nx.test.":
+			m.Rcode = mdns.RcodeNameError
+		default:
+			m.Rcode = mdns.RcodeServerFailure
+		}
+		w.WriteMsg(m)
+	})
+	server := &mdns.Server{PacketConn: conn, Handler: handler}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+func TestRunExitCode(t *testing.T) {
+	address := serveTestZone(t)
+	dir := t.TempDir()
+	config := func(name string, servers string, domains string) string {
+		path := filepath.Join(dir, name+".yaml")
+		content := fmt.Sprintf("servers:\n%s\ndomains:\n%s\n", servers, domains)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	server := fmt.Sprintf("  - name: a\n    address: %q\n    protocols: [udp]", address)
+	critical := fmt.Sprintf("  - name: critical\n    address: %q\n    protocols: [udp]\n    critical: true", address)
+	expectNX := "  - name: nx.test\n    expect:\n      rcode: NXDOMAIN"
+	unmetNX := "  - name: ok.test\n    expect:\n      rcode: NXDOMAIN"
+
+	passing := config("passing", server, "  - ok.test\n"+expectNX)
+	servfail := config("servfail", server, "  - ok.test\n  - fail.test")
+	unmet := config("unmet", server, "  - ok.test\n"+unmetNX)
+	both := config("both", server, "  - fail.test\n"+unmetNX)
+	quarter := config("quarter", server, "  - ok.test\n  - ok.test\n  - ok.test\n  - fail.test")
+	criticalUnmet := config("critical", server+"\n"+critical, unmetNX)
+	invalid := config("invalid", server, "  - name: ok.test\n    expect:\n      rcode: NOPE")
+	output := filepath.Join(dir, "report.json")
+	unwritable := filepath.Join(dir, "missing", "report.json")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"all queries pass", []string{"-config", passing}, exitOK},
+		{"query failure", []string{"-config", servfail}, exitQueryFailures},
+		{"unmet expectation", []string{"-config", unmet}, exitAssertionFailures},
+		{"query failures take precedence over unmet expectations", []string{"-config", both}, exitQueryFailures},
+		{"failures within the threshold", []string{"-config", quarter, "-fail-on", "threshold=25%"}, exitOK},
+		{"failures above the threshold", []string{"-config", quarter, "-fail-on", "threshold=20"}, exitQueryFailures},
+		{"a server is up", []string{"-config", quarter, "-fail-on", "all-servers-down"}, exitOK},
+		{"critical servers fail the run under any policy", []string{"-config", criticalUnmet, "-fail-on", "all-servers-down"}, exitAssertionFailures},
+		{"invalid failure policy", []string{"-config", passing, "-fail-on", "sometimes"}, exitConfigError},
+		{"invalid configuration", []string{"-config", invalid}, exitConfigError},
+		{"missing configuration", []string{"-config", filepath.Join(dir, "missing.yaml")}, exitConfigError},
+		{"unknown flag", []string{"-config", passing, "-bogus"}, exitConfigError},
+		{"help", []string{"-h"}, exitOK},
+		{"report error takes precedence over failures", []string{"-config", servfail, "-format", "json", "-output", unwritable}, exitError},
+		{"report written", []string{"-config", servfail, "-format", "json", "-output", output}, exitQueryFailures},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := runTests(test.args); got != test.want {
+				t.Errorf("exit code %d, want %d", got, test.want)
+			}
+		})
+	}
+}
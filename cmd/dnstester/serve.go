@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"dnstester/internal/config"
+	"dnstester/internal/history"
+	"dnstester/internal/server"
+)
+
+// runServe implements "dnstester serve": it serves the WebUI and HTTP API until the server fails. With
+// -monitor, the tests from the config file also run in the background and /metrics is exposed.
+func runServe(args []string) int {
+	flags := newFlagSet("serve", "")
+	addr := flags.String("addr", ":8080", "Server address")
+	historyDir := flags.String("history", "history", "Directory where past runs are stored (empty to disable)")
+	historyMaxRuns := flags.Int("history-max-runs", 1000, "Number of past runs to keep, deleting the oldest (0 for no limit)")
+	historyMaxAge := flags.Duration("history-max-age", 30*24*time.Hour, "Delete past runs older than this (0 for no limit)")
+	monitorMode := flags.Bool("monitor", false, "Run the tests from -config on the monitor schedule in the background, exposing /metrics")
+	configFile := flags.String("config", "config.yaml", "Path to YAML configuration file, for -monitor")
+	concurrency := flags.Int("concurrency", 0, "Maximum monitor queries in flight (default: config value or 10)")
+	legacyFlag(flags, "server")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+
+	var opts server.Options
+	if *monitorMode {
+		cfg, err := config.LoadConfig(*configFile)
+		if err != nil {
+			return failf(exitConfigError, "Failed to load config: %v", err)
+		}
+		opts.Monitor = cfg
+		opts.Concurrency = *concurrency
+		if opts.Concurrency <= 0 {
+			opts.Concurrency = cfg.Concurrency
+		}
+	}
+	if *historyDir != "" {
+		store, err := history.Open(*historyDir, history.Retention{MaxRuns: *historyMaxRuns, MaxAge: *historyMaxAge})
+		if err != nil {
+			return failf(exitError, "Failed to open history: %v", err)
+		}
+		opts.History = store
+	}
+
+	log.Printf("Starting DNS Tester server on %s", *addr)
+	if err := server.StartServer(*addr, opts); err != nil {
+		return failf(exitError, "Failed to start server: %v", err)
+	}
+	return exitOK
+}
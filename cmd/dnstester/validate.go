@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"dnstester/internal/config"
+	"dnstester/internal/runner"
+)
+
+// runValidate implements "dnstester validate": it loads a config file, reporting the first problem,
+// and summarises the test matrix it describes.
+func runValidate(args []string) int {
+	flags := newFlagSet("validate", " [config.yaml]")
+	configFile := flags.String("config", "config.yaml", "Path to YAML configuration file")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		*configFile = flags.Arg(0)
+	default:
+		return usageError(flags, fmt.Errorf("expected one config file, got %d", flags.NArg()))
+	}
+
+	cfg, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return failf(exitConfigError, "%s: %v", *configFile, err)
+	}
+	fmt.Printf("%s: valid (%d domain(s), %d server(s), %d queries per run)\n",
+		*configFile, len(cfg.Domains), len(cfg.Servers), len(runner.Plan(cfg)))
+	return exitOK
+}
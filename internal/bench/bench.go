@@ -0,0 +1,291 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"dnstester/internal/config"
+	"dnstester/internal/dns"
+	"dnstester/internal/report"
+	"dnstester/pkg/types"
+
+	mdns "github.com/miekg/dns"
+)
+
+// DefaultClients is the number of concurrent clients used when Options.Clients is not set.
+const DefaultClients = 10
+
+// DefaultDuration is the benchmark length used when Options.Duration is not set.
+const DefaultDuration = 10 * time.Second
+
+// HistogramBounds are the upper bounds, in milliseconds, of the latency histogram buckets. A final
+// bucket collects everything above the last bound.
+var HistogramBounds = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// Options configures a benchmark run.
+type Options struct {
+	Server     types.Server // with defaults applied, see config.ApplyDefaults
+	Protocol   string
+	Domains    []types.Domain
+	QueryTypes []string // global query types, see config.QueryTypesFor
+
+	// Clients is the number of concurrent clients, each with its own connection. Values <= 0 use
+	// DefaultClients.
+	Clients int
+	// QPS is the target query rate across all clients. When 0, each client sends its next query as
+	// soon as the previous one completes.
+	QPS float64
+	// Duration is how long queries are sent for. Values <= 0 use DefaultDuration.
+	Duration time.Duration
+}
+
+// clientStats collects the outcomes seen by one client; clients are merged when the run ends.
+type clientStats struct {
+	sent, responses, timeouts, errors, connections int
+	firstError                                     string
+	latencies                                      []float64
+	rcodes                                         map[string]int
+}
+
+// Run sends the server × domain × query type queries in rotation for the configured duration and
+// reports the achieved rate, latency distribution, timeouts and rcodes. Each client keeps its
+// connection open (see dns.OpenSession) and reconnects after a failed exchange.
+func Run(ctx context.Context, opts Options) (types.BenchReport, error) {
+	if _, ok := dns.LookupTransport(opts.Protocol); !ok {
+		return types.BenchReport{}, fmt.Errorf("unsupported protocol: %s", opts.Protocol)
+	}
+	queries, err := buildQueries(opts)
+	if err != nil {
+		return types.BenchReport{}, err
+	}
+
+	clients := opts.Clients
+	if clients <= 0 {
+		clients = DefaultClients
+	}
+	duration := opts.Duration
+	if duration <= 0 {
+		duration = DefaultDuration
+	}
+
+	start := time.Now()
+	deadline := start.Add(duration)
+	var next atomic.Int64
+	stats := make([]clientStats, clients)
+
+	var wg sync.WaitGroup
+	for i := range stats {
+		wg.Add(1)
+		go func(stats *clientStats) {
+			defer wg.Done()
+			runClient(ctx, opts, queries, start, deadline, &next, stats)
+		}(&stats[i])
+	}
+	wg.Wait()
+
+	return buildReport(opts, clients, time.Since(start), stats), nil
+}
+
+// buildQueries expands the domains and their query types into query messages.
+func buildQueries(opts Options) ([]*mdns.Msg, error) {
+	var queries []*mdns.Msg
+	for _, domain := range opts.Domains {
+		for _, queryType := range config.QueryTypesFor(opts.QueryTypes, opts.Server, domain) {
+			msg, err := dns.NewQuery(opts.Server, domain.Name, queryType)
+			if err != nil {
+				return nil, fmt.Errorf("domain %s: %w", domain.Name, err)
+			}
+			queries = append(queries, msg)
+		}
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no queries to send")
+	}
+	return queries, nil
+}
+
+// connectBackoff is the longest a client waits after failing to connect before trying again, so that
+// a refused connection does not turn into a busy loop of failed queries.
+const connectBackoff = 100 * time.Millisecond
+
+// runClient sends queries until the deadline. With a target rate, query n is due at start + n/QPS
+// across all clients; a client that falls behind sends immediately, so the achieved rate shows
+// when the server or the clients cannot keep up. Each client is closed-loop, sending a query only
+// after the previous one completed, so the rate is capped at clients / latency whatever the target.
+// Without a target rate, a client that fails to connect waits connectBackoff (or the timeout, if
+// shorter) before its next query.
+func runClient(ctx context.Context, opts Options, queries []*mdns.Msg, start, deadline time.Time, next *atomic.Int64, stats *clientStats) {
+	stats.rcodes = make(map[string]int)
+	timeout := time.Duration(opts.Server.Timeout)
+	if timeout <= 0 {
+		timeout = dns.DefaultTimeout
+	}
+
+	var session dns.Session
+	var sessionUses int
+	defer func() {
+		if session != nil {
+			session.Close()
+		}
+	}()
+
+	for {
+		seq := next.Add(1) - 1
+		if opts.QPS > 0 {
+			due := start.Add(time.Duration(float64(seq) / opts.QPS * float64(time.Second)))
+			if !due.Before(deadline) {
+				return
+			}
+			select {
+			case <-time.After(time.Until(due)):
+			case <-ctx.Done():
+				return
+			}
+		} else if !time.Now().Before(deadline) || ctx.Err() != nil {
+			return
+		}
+
+		query := queries[seq%int64(len(queries))].Copy()
+		query.Id = mdns.Id()
+		stats.sent++
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		var r *mdns.Msg
+		var latency time.Duration
+		var err error
+		var connectFailed bool
+		// A server may close an idle or long-used connection (e.g. after a query limit); the query is
+		// then resent once on a new connection instead of counting as an error.
+		for retry := true; retry; {
+			retry = false
+			if session == nil {
+				trace := &dns.Trace{}
+				session, err = dns.OpenSession(dns.WithTrace(attemptCtx, trace), opts.Server, opts.Protocol)
+				if err != nil {
+					connectFailed = true
+					break
+				}
+				sessionUses = 0
+				if trace.Connect > 0 || trace.TLSHandshake > 0 {
+					stats.connections++
+				}
+			}
+
+			trace := &dns.Trace{}
+			sent := time.Now()
+			r, err = session.Exchange(dns.WithTrace(attemptCtx, trace), query)
+			latency = time.Since(sent)
+			if trace.Connect > 0 || trace.TLSHandshake > 0 {
+				stats.connections++
+			}
+			if err != nil {
+				retry = sessionUses > 0 && connectionClosed(err)
+				session.Close()
+				session = nil
+			} else {
+				sessionUses++
+			}
+		}
+		cancel()
+
+		if err != nil {
+			stats.fail(err)
+			if connectFailed && opts.QPS == 0 {
+				select {
+				case <-time.After(min(connectBackoff, timeout, time.Until(deadline))):
+				case <-ctx.Done():
+					return
+				}
+			}
+			continue
+		}
+		stats.responses++
+		stats.latencies = append(stats.latencies, float64(latency.Microseconds())/1000)
+		stats.rcodes[dns.RcodeName(r.Rcode)]++
+	}
+}
+
+// connectionClosed reports whether an exchange failed because the server had closed the connection.
+func connectionClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, net.ErrClosed)
+}
+
+// fail counts a failed query as a timeout or an error.
+func (s *clientStats) fail(err error) {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		s.timeouts++
+	} else {
+		s.errors++
+	}
+	if s.firstError == "" {
+		s.firstError = err.Error()
+	}
+}
+
+// buildReport merges the client statistics.
+func buildReport(opts Options, clients int, elapsed time.Duration, stats []clientStats) types.BenchReport {
+	result := types.BenchReport{
+		ServerName:    opts.Server.Name,
+		ServerAddress: opts.Server.Address,
+		Protocol:      opts.Protocol,
+		Clients:       clients,
+		TargetQPS:     opts.QPS,
+		Duration:      elapsed.Seconds(),
+		Rcodes:        make(map[string]int),
+	}
+
+	var latencies []float64
+	for _, s := range stats {
+		result.Sent += s.sent
+		result.Responses += s.responses
+		result.Timeouts += s.timeouts
+		result.Errors += s.errors
+		result.Connections += s.connections
+		if result.FirstError == "" {
+			result.FirstError = s.firstError
+		}
+		latencies = append(latencies, s.latencies...)
+		for rcode, count := range s.rcodes {
+			result.Rcodes[rcode] += count
+		}
+	}
+
+	if result.Duration > 0 {
+		result.AchievedQPS = float64(result.Responses) / result.Duration
+	}
+	if result.Sent > 0 {
+		result.TimeoutRate = float64(result.Timeouts) / float64(result.Sent)
+	}
+	result.Latency = report.Latency(latencies)
+	result.Histogram = histogram(latencies)
+	return result
+}
+
+// histogram counts latencies into the HistogramBounds buckets.
+func histogram(latencies []float64) []types.HistogramBucket {
+	buckets := make([]types.HistogramBucket, len(HistogramBounds)+1)
+	lower := 0.0
+	for i, bound := range HistogramBounds {
+		buckets[i] = types.HistogramBucket{LowerBound: lower, UpperBound: bound}
+		lower = bound
+	}
+	buckets[len(HistogramBounds)] = types.HistogramBucket{LowerBound: lower}
+
+	for _, latency := range latencies {
+		i := 0
+		for i < len(HistogramBounds) && latency >= HistogramBounds[i] {
+			i++
+		}
+		buckets[i].Count++
+	}
+	return buckets
+}
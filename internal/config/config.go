@@ -3,7 +3,10 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"dnstester/internal/dns"
+	"dnstester/internal/expect"
 	"dnstester/pkg/types"
 
 	"gopkg.in/yaml.v3"
@@ -22,27 +25,121 @@ func LoadConfig(filePath string) (*types.Config, error) {
 		return nil, fmt.Errorf("failed to parse YAML: %w", err)
 	}
 
-	if err := validateConfig(&config); err != nil {
+	if err := Validate(&config); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
+	ApplyDefaults(&config)
 	return &config, nil
 }
 
-// validateConfig validates the configuration structure. Valid protocols are: udp, tcp, dot, doh.
-func validateConfig(config *types.Config) error {
+// ApplyDefaults copies the global timeout, retries, retry backoff, DNSSEC and EDNS options and monitor
+// interval into every server that does not set its own, so each server carries its effective settings.
+func ApplyDefaults(config *types.Config) {
+	for i := range config.Servers {
+		server := &config.Servers[i]
+		if server.Timeout == 0 {
+			server.Timeout = config.Timeout
+		}
+		if server.Retries == nil {
+			retries := config.Retries
+			server.Retries = &retries
+		}
+		if server.RetryBackoff == 0 {
+			server.RetryBackoff = config.RetryBackoff
+		}
+		if server.DNSSEC == nil {
+			server.DNSSEC = config.DNSSEC
+		}
+		if server.EDNS == nil {
+			server.EDNS = config.EDNS
+		}
+		if server.Interval == 0 {
+			server.Interval = config.Monitor.Interval
+		}
+	}
+}
+
+// DefaultQueryType is used when no query types are configured at any level.
+const DefaultQueryType = "A"
+
+// QueryTypesFor returns the query types to use for a domain on a server. Domain-level types
+// take precedence over server-level types, which take precedence over the global list.
+func QueryTypesFor(global []string, server types.Server, domain types.Domain) []string {
+	switch {
+	case len(domain.QueryTypes) > 0:
+		return domain.QueryTypes
+	case len(server.QueryTypes) > 0:
+		return server.QueryTypes
+	case len(global) > 0:
+		return global
+	default:
+		return []string{DefaultQueryType}
+	}
+}
+
+// Validate validates the configuration structure, before defaults are applied. Valid protocols are
+// those with a transport registered in internal/dns (see dns.Protocols).
+// Query types must be record type names known to github.com/miekg/dns (e.g. A, AAAA, MX, HTTPS).
+func Validate(config *types.Config) error {
 	if len(config.Domains) == 0 {
 		return fmt.Errorf("no domains defined")
 	}
 
+	if err := validateQueryTypes(config.QueryTypes); err != nil {
+		return err
+	}
+
+	if config.Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative")
+	}
+	if err := validateRetrySettings(config.Timeout, &config.Retries, config.RetryBackoff); err != nil {
+		return err
+	}
+	if err := validateDNSSECOptions(config.DNSSEC); err != nil {
+		return err
+	}
+	if err := validateEDNSOptions(config.EDNS); err != nil {
+		return err
+	}
+	if err := validateMonitorOptions(config.Monitor); err != nil {
+		return fmt.Errorf("monitor: %w", err)
+	}
+
+	for i, domain := range config.Domains {
+		if domain.Name == "" {
+			return fmt.Errorf("domain %d: name is required", i)
+		}
+		if err := validateQueryTypes(domain.QueryTypes); err != nil {
+			return fmt.Errorf("domain %d: %w", i, err)
+		}
+		if err := validateDNSSECOptions(domain.DNSSEC); err != nil {
+			return fmt.Errorf("domain %d: %w", i, err)
+		}
+		if err := validateEDNSOptions(domain.EDNS); err != nil {
+			return fmt.Errorf("domain %d: %w", i, err)
+		}
+		if domain.Expect != nil {
+			if err := expect.Validate(*domain.Expect); err != nil {
+				return fmt.Errorf("domain %d: expect: %w", i, err)
+			}
+		}
+	}
+
 	if len(config.Servers) == 0 {
 		return fmt.Errorf("no servers defined")
 	}
 
+	// Reports, failure policies and metrics tell servers apart by name
+	names := make(map[string]bool)
 	for i, server := range config.Servers {
 		if server.Name == "" {
 			return fmt.Errorf("server %d: name is required", i)
 		}
+		if names[server.Name] {
+			return fmt.Errorf("server %d: duplicate server name '%s'", i, server.Name)
+		}
+		names[server.Name] = true
 		if server.Address == "" {
 			return fmt.Errorf("server %d: address is required", i)
 		}
@@ -50,19 +147,135 @@ func validateConfig(config *types.Config) error {
 			return fmt.Errorf("server %d: at least one protocol must be specified", i)
 		}
 
-		validProtocols := map[string]bool{
-			"udp": true,
-			"tcp": true,
-			"dot": true,
-			"doh": true,
-		}
-
 		for _, protocol := range server.Protocols {
-			if !validProtocols[protocol] {
-				return fmt.Errorf("server %d: invalid protocol '%s'. Must be one of: udp, tcp, dot, doh", i, protocol)
+			if _, ok := dns.LookupTransport(protocol); !ok {
+				return fmt.Errorf("server %d: invalid protocol '%s'. Must be one of: %s",
+					i, protocol, strings.Join(dns.Protocols(), ", "))
 			}
 		}
+
+		if err := validateQueryTypes(server.QueryTypes); err != nil {
+			return fmt.Errorf("server %d: %w", i, err)
+		}
+		if server.MaxConcurrency < 0 {
+			return fmt.Errorf("server %d: max_concurrency must not be negative", i)
+		}
+		if err := validateRetrySettings(server.Timeout, server.Retries, server.RetryBackoff); err != nil {
+			return fmt.Errorf("server %d: %w", i, err)
+		}
+		if err := validateDoHOptions(server.DoH); err != nil {
+			return fmt.Errorf("server %d: %w", i, err)
+		}
+		if err := validateDNSSECOptions(server.DNSSEC); err != nil {
+			return fmt.Errorf("server %d: %w", i, err)
+		}
+		if err := validateEDNSOptions(server.EDNS); err != nil {
+			return fmt.Errorf("server %d: %w", i, err)
+		}
+		if server.Interval < 0 {
+			return fmt.Errorf("server %d: interval must not be negative", i)
+		}
 	}
 
+	return ValidateConsistency(config)
+}
+
+// ValidateConsistency checks that the consistency reference, if set, names a configured server.
+func ValidateConsistency(config *types.Config) error {
+	reference := config.Consistency.Reference
+	if reference == "" {
+		return nil
+	}
+	for _, server := range config.Servers {
+		if server.Name == reference {
+			return nil
+		}
+	}
+	return fmt.Errorf("consistency reference '%s' is not a configured server name", reference)
+}
+
+// validateMonitorOptions checks that monitor intervals, window and thresholds are not negative.
+func validateMonitorOptions(options types.MonitorOptions) error {
+	if options.Interval < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	if options.Window < 0 {
+		return fmt.Errorf("window must not be negative")
+	}
+	if options.FailureThreshold < 0 || options.RecoveryThreshold < 0 {
+		return fmt.Errorf("thresholds must not be negative")
+	}
+	return nil
+}
+
+// validateRetrySettings rejects negative timeouts, retry counts and backoffs. retries may be nil.
+func validateRetrySettings(timeout types.Duration, retries *int, backoff types.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if retries != nil && *retries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	if backoff < 0 {
+		return fmt.Errorf("retry_backoff must not be negative")
+	}
+	return nil
+}
+
+// validateDoHOptions checks the DoH method, HTTP version and format against the supported values.
+func validateDoHOptions(options types.DoHOptions) error {
+	switch strings.ToLower(options.Method) {
+	case "", types.DoHMethodPost, types.DoHMethodGet:
+	default:
+		return fmt.Errorf("invalid doh method '%s'. Must be one of: post, get", options.Method)
+	}
+	switch options.HTTPVersion {
+	case "", types.HTTPVersion1, types.HTTPVersion2:
+	default:
+		return fmt.Errorf("invalid doh http_version '%s'. Must be one of: 1.1, 2", options.HTTPVersion)
+	}
+	switch strings.ToLower(options.Format) {
+	case "", types.DoHFormatWire, types.DoHFormatJSON:
+	default:
+		return fmt.Errorf("invalid doh format '%s'. Must be one of: wire, json", options.Format)
+	}
+	return nil
+}
+
+// validateDNSSECOptions checks that configured trust anchors parse as DS or DNSKEY records.
+func validateDNSSECOptions(options *types.DNSSECOptions) error {
+	if options == nil {
+		return nil
+	}
+	if _, err := dns.ParseTrustAnchors(options.TrustAnchors); err != nil {
+		return fmt.Errorf("dnssec: %w", err)
+	}
+	return nil
+}
+
+// validateEDNSOptions checks that the client subnet is a valid prefix and that the UDP size is at
+// least the 512 bytes every DNS client may send.
+func validateEDNSOptions(options *types.EDNSOptions) error {
+	if options == nil {
+		return nil
+	}
+	if options.UDPSize != 0 && options.UDPSize < 512 {
+		return fmt.Errorf("edns: udp_size must be at least 512")
+	}
+	if options.ClientSubnet != "" {
+		if _, err := dns.ParseClientSubnet(options.ClientSubnet); err != nil {
+			return fmt.Errorf("edns: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateQueryTypes checks that every query type name is recognised.
+func validateQueryTypes(queryTypes []string) error {
+	for _, queryType := range queryTypes {
+		if _, err := dns.ParseQueryType(queryType); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,456 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+)
+
+// RootTrustAnchors are the DS records of the root zone KSKs (KSK-2017 and KSK-2024), used when a
+// server validates without configuring its own trust anchors.
+var RootTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// ParseTrustAnchors parses DS or DNSKEY records in presentation format. RootTrustAnchors are returned
+// when anchors is empty.
+func ParseTrustAnchors(anchors []string) ([]dns.RR, error) {
+	if len(anchors) == 0 {
+		anchors = RootTrustAnchors
+	}
+
+	parsed := make([]dns.RR, 0, len(anchors))
+	for _, anchor := range anchors {
+		rr, err := dns.NewRR(anchor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trust anchor %q: %w", anchor, err)
+		}
+		switch rr.(type) {
+		case *dns.DS, *dns.DNSKEY:
+			parsed = append(parsed, rr)
+		default:
+			return nil, fmt.Errorf("invalid trust anchor %q: must be a DS or DNSKEY record", anchor)
+		}
+	}
+	return parsed, nil
+}
+
+// dnssecOptions returns the server's DNSSEC options, or the zero options when none are set.
+func dnssecOptions(server types.Server) types.DNSSECOptions {
+	if server.DNSSEC == nil {
+		return types.DNSSECOptions{}
+	}
+	return *server.DNSSEC
+}
+
+// applyDNSSECOptions sets the DO and CD bits requested by the server's dnssec options. Validation
+// needs the signatures, so it implies DO.
+func applyDNSSECOptions(msg *dns.Msg, options types.DNSSECOptions) {
+	if options.DO || options.Validate {
+		msg.SetEdns0(dns.DefaultMsgSize, true)
+	}
+	msg.CheckingDisabled = options.CD
+}
+
+// validator verifies responses locally by following the chain of trust from a trust anchor down to
+// the signer of each RRset. DNSKEY and DS records are fetched from the server under test with the DO
+// and CD bits set, so the server's own validation does not hide bogus data.
+type validator struct {
+	transport Transport
+	server    types.Server
+	timeout   time.Duration
+	anchors   []dns.RR
+	now       time.Time
+	zones     map[string]*zoneTrust
+}
+
+// zoneTrust is the validated state of a zone's DNSKEY RRset.
+type zoneTrust struct {
+	status string
+	keys   []*dns.DNSKEY
+	reason string
+}
+
+// validateResponse returns the DNSSEC status of the answer section of r (the authority section for
+// negative responses), along with a reason when the status is not secure. Each lookup made while
+// following the chain of trust is bounded by timeout.
+func validateResponse(ctx context.Context, transport Transport, server types.Server, r *dns.Msg, timeout time.Duration) (string, string) {
+	anchors, err := ParseTrustAnchors(dnssecOptions(server).TrustAnchors)
+	if err != nil {
+		return types.DNSSECIndeterminate, err.Error()
+	}
+
+	v := &validator{
+		transport: transport,
+		server:    server,
+		timeout:   timeout,
+		anchors:   anchors,
+		now:       time.Now(),
+		zones:     make(map[string]*zoneTrust),
+	}
+
+	section := r.Answer
+	if len(section) == 0 {
+		// NXDOMAIN/NODATA: the SOA and NSEC/NSEC3 records in the authority section must be signed.
+		// The denial-of-existence proof itself is not checked.
+		section = r.Ns
+	}
+	if len(section) == 0 {
+		return types.DNSSECIndeterminate, "response has no records to validate"
+	}
+
+	status := types.DNSSECSecure
+	reason := ""
+	for _, rrset := range splitRRsets(section) {
+		setStatus, setReason := v.validateRRset(ctx, rrset, section)
+		if rank(setStatus) > rank(status) {
+			status, reason = setStatus, setReason
+		}
+	}
+	return status, reason
+}
+
+// rank orders statuses so the worst one across RRsets determines the overall result.
+func rank(status string) int {
+	switch status {
+	case types.DNSSECSecure:
+		return 0
+	case types.DNSSECInsecure:
+		return 1
+	case types.DNSSECIndeterminate:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// validateRRset verifies rrset against the RRSIGs in section using the signer zone's trusted keys.
+// An unsigned RRset is insecure if its zone is provably unsigned, and bogus otherwise.
+func (v *validator) validateRRset(ctx context.Context, rrset []dns.RR, section []dns.RR) (string, string) {
+	header := rrset[0].Header()
+	sigs := coveringSignatures(section, header.Name, header.Rrtype)
+	owner := fmt.Sprintf("%s %s", header.Name, dns.TypeToString[header.Rrtype])
+
+	zone, err := v.zoneOf(ctx, header.Name)
+	if err != nil {
+		return types.DNSSECIndeterminate, err.Error()
+	}
+
+	if len(sigs) == 0 {
+		trust := v.trust(ctx, zone)
+		switch trust.status {
+		case types.DNSSECInsecure:
+			return types.DNSSECInsecure, fmt.Sprintf("%s is in unsigned zone %s", owner, zone)
+		case types.DNSSECSecure:
+			return types.DNSSECBogus, fmt.Sprintf("%s has no RRSIG but zone %s is signed", owner, zone)
+		default:
+			return trust.status, trust.reason
+		}
+	}
+
+	// RFC 4035 section 5.3.1: the signer must be the zone containing the RRset. RRSIG.Verify does
+	// not check it, so without this any trusted zone could sign data for any name. A signature from
+	// an insecure signer only makes the RRset insecure if no other signature validates it.
+	var lastReason, insecureReason string
+	for _, sig := range sigs {
+		if dns.CanonicalName(sig.SignerName) != zone {
+			lastReason = fmt.Sprintf("%s is signed by %s, which is not its zone %s", owner, sig.SignerName, zone)
+			continue
+		}
+		trust := v.trust(ctx, zone)
+		if trust.status == types.DNSSECInsecure {
+			insecureReason = trust.reason
+			continue
+		}
+		if trust.status != types.DNSSECSecure {
+			lastReason = trust.reason
+			continue
+		}
+		if err := v.verify(sig, trust.keys, rrset); err != nil {
+			lastReason = fmt.Sprintf("%s: %v", owner, err)
+			continue
+		}
+		return types.DNSSECSecure, ""
+	}
+	if insecureReason != "" {
+		return types.DNSSECInsecure, insecureReason
+	}
+	return types.DNSSECBogus, lastReason
+}
+
+// verify checks sig over rrset with the matching key and the signature validity period.
+func (v *validator) verify(sig *dns.RRSIG, keys []*dns.DNSKEY, rrset []dns.RR) error {
+	if !sig.ValidityPeriod(v.now) {
+		return fmt.Errorf("RRSIG by key %d is outside its validity period", sig.KeyTag)
+	}
+	for _, key := range keys {
+		if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+			continue
+		}
+		if err := sig.Verify(key, rrset); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("no DNSKEY with tag %d verifies the RRSIG", sig.KeyTag)
+}
+
+// trust returns the validated DNSKEYs of zone, walking up through DS records to a trust anchor.
+func (v *validator) trust(ctx context.Context, zone string) *zoneTrust {
+	zone = dns.CanonicalName(zone)
+	if cached, ok := v.zones[zone]; ok {
+		return cached
+	}
+	// Guard against loops while the chain above this zone is being established.
+	v.zones[zone] = &zoneTrust{status: types.DNSSECIndeterminate, reason: "chain of trust loops at " + zone}
+
+	trust := v.establish(ctx, zone)
+	v.zones[zone] = trust
+	return trust
+}
+
+// establish validates a zone's DNSKEY RRset against a trust anchor for the zone, or against the DS
+// RRset published (and signed) by its parent.
+func (v *validator) establish(ctx context.Context, zone string) *zoneTrust {
+	var dsSet []*dns.DS
+	var anchorKeys []*dns.DNSKEY
+	for _, anchor := range v.anchors {
+		if dns.CanonicalName(anchor.Header().Name) != zone {
+			continue
+		}
+		switch a := anchor.(type) {
+		case *dns.DS:
+			dsSet = append(dsSet, a)
+		case *dns.DNSKEY:
+			anchorKeys = append(anchorKeys, a)
+		}
+	}
+
+	if len(dsSet) == 0 && len(anchorKeys) == 0 {
+		if zone == "." {
+			return &zoneTrust{status: types.DNSSECIndeterminate, reason: "no trust anchor configured above the zone"}
+		}
+		parentDS, trust := v.delegation(ctx, zone)
+		if trust != nil {
+			return trust
+		}
+		dsSet = parentDS
+	}
+
+	r, err := v.fetch(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return &zoneTrust{status: types.DNSSECIndeterminate, reason: fmt.Sprintf("fetching DNSKEY for %s: %v", zone, err)}
+	}
+
+	var keys []*dns.DNSKEY
+	var keyRRs []dns.RR
+	for _, rr := range r.Answer {
+		if key, ok := rr.(*dns.DNSKEY); ok && dns.CanonicalName(key.Hdr.Name) == zone {
+			keys = append(keys, key)
+			keyRRs = append(keyRRs, key)
+		}
+	}
+	if len(keys) == 0 {
+		return &zoneTrust{status: types.DNSSECBogus, reason: fmt.Sprintf("%s has a DS or trust anchor but no DNSKEY", zone)}
+	}
+
+	// The DNSKEY RRset must be signed by a key that matches the DS set or a trusted DNSKEY.
+	trusted := trustedKeys(keys, dsSet, anchorKeys)
+	for _, sig := range coveringSignatures(r.Answer, zone, dns.TypeDNSKEY) {
+		if dns.CanonicalName(sig.SignerName) != zone {
+			continue
+		}
+		if err := v.verify(sig, trusted, keyRRs); err == nil {
+			return &zoneTrust{status: types.DNSSECSecure, keys: keys}
+		}
+	}
+	return &zoneTrust{status: types.DNSSECBogus, reason: fmt.Sprintf("DNSKEY RRset of %s is not signed by a trusted key", zone)}
+}
+
+// delegation fetches and validates the DS RRset for zone from its parent. It returns either the
+// validated DS records, or a final trust when the delegation is insecure or cannot be validated.
+func (v *validator) delegation(ctx context.Context, zone string) ([]*dns.DS, *zoneTrust) {
+	r, err := v.fetch(ctx, zone, dns.TypeDS)
+	if err != nil {
+		return nil, &zoneTrust{status: types.DNSSECIndeterminate, reason: fmt.Sprintf("fetching DS for %s: %v", zone, err)}
+	}
+	// The DS RRset and its denial are published and signed by the parent zone
+	parent, err := v.zoneOf(ctx, parentZone(zone))
+	if err != nil {
+		return nil, &zoneTrust{status: types.DNSSECIndeterminate, reason: err.Error()}
+	}
+
+	var dsSet []*dns.DS
+	var dsRRs []dns.RR
+	for _, rr := range r.Answer {
+		if ds, ok := rr.(*dns.DS); ok && dns.CanonicalName(ds.Hdr.Name) == zone {
+			dsSet = append(dsSet, ds)
+			dsRRs = append(dsRRs, ds)
+		}
+	}
+
+	if len(dsSet) == 0 {
+		// No DS: the delegation is insecure if the parent is insecure, or if the parent signs the
+		// negative answer. NSEC/NSEC3 type bitmaps are not checked.
+		sigs := signaturesIn(r.Ns)
+		if len(sigs) == 0 {
+			if trust := v.trust(ctx, parent); trust.status != types.DNSSECSecure {
+				return nil, trust
+			}
+			return nil, &zoneTrust{status: types.DNSSECBogus, reason: fmt.Sprintf("unsigned DS denial for %s from signed parent", zone)}
+		}
+		if signer := dns.CanonicalName(sigs[0].SignerName); signer != parent {
+			return nil, &zoneTrust{status: types.DNSSECBogus, reason: fmt.Sprintf("DS denial for %s is signed by %s, which is not its parent zone %s", zone, signer, parent)}
+		}
+		parentTrust := v.trust(ctx, parent)
+		if parentTrust.status != types.DNSSECSecure {
+			return nil, parentTrust
+		}
+		for _, rrset := range splitRRsets(r.Ns) {
+			header := rrset[0].Header()
+			verified := false
+			for _, sig := range coveringSignatures(r.Ns, header.Name, header.Rrtype) {
+				if dns.CanonicalName(sig.SignerName) != parent {
+					continue
+				}
+				if v.verify(sig, parentTrust.keys, rrset) == nil {
+					verified = true
+					break
+				}
+			}
+			if !verified {
+				return nil, &zoneTrust{status: types.DNSSECBogus, reason: fmt.Sprintf("DS denial for %s does not validate", zone)}
+			}
+		}
+		return nil, &zoneTrust{status: types.DNSSECInsecure, reason: fmt.Sprintf("%s is an unsigned delegation", zone)}
+	}
+
+	sigs := coveringSignatures(r.Answer, zone, dns.TypeDS)
+	if len(sigs) == 0 {
+		return nil, &zoneTrust{status: types.DNSSECBogus, reason: fmt.Sprintf("DS RRset of %s is unsigned", zone)}
+	}
+	reason := fmt.Sprintf("DS RRset of %s does not validate", zone)
+	for _, sig := range sigs {
+		if dns.CanonicalName(sig.SignerName) != parent {
+			reason = fmt.Sprintf("DS RRset of %s is signed by %s, which is not its parent zone %s", zone, sig.SignerName, parent)
+			continue
+		}
+		parentTrust := v.trust(ctx, parent)
+		if parentTrust.status != types.DNSSECSecure {
+			return nil, parentTrust
+		}
+		if v.verify(sig, parentTrust.keys, dsRRs) == nil {
+			return dsSet, nil
+		}
+	}
+	return nil, &zoneTrust{status: types.DNSSECBogus, reason: reason}
+}
+
+// zoneOf finds the zone containing name from the owner of the SOA record returned for it.
+func (v *validator) zoneOf(ctx context.Context, name string) (string, error) {
+	r, err := v.fetch(ctx, name, dns.TypeSOA)
+	if err != nil {
+		return "", fmt.Errorf("fetching SOA for %s: %w", name, err)
+	}
+	for _, rr := range append(r.Answer, r.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return dns.CanonicalName(soa.Hdr.Name), nil
+		}
+	}
+	return "", fmt.Errorf("no SOA found for %s", name)
+}
+
+// fetch queries the server under test with DO and CD set.
+func (v *validator) fetch(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	msg.SetEdns0(dns.DefaultMsgSize, true)
+	msg.CheckingDisabled = true
+
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	r, err := v.transport.Exchange(ctx, v.server, msg)
+	if err != nil {
+		return nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+		return nil, errRcode(r.Rcode)
+	}
+	return r, nil
+}
+
+// trustedKeys returns the keys that match a DS record or equal a trusted DNSKEY.
+func trustedKeys(keys []*dns.DNSKEY, dsSet []*dns.DS, anchorKeys []*dns.DNSKEY) []*dns.DNSKEY {
+	var trusted []*dns.DNSKEY
+	for _, key := range keys {
+		for _, ds := range dsSet {
+			computed := key.ToDS(ds.DigestType)
+			if computed != nil && computed.KeyTag == ds.KeyTag && strings.EqualFold(computed.Digest, ds.Digest) {
+				trusted = append(trusted, key)
+			}
+		}
+		for _, anchor := range anchorKeys {
+			if key.Algorithm == anchor.Algorithm && key.PublicKey == anchor.PublicKey {
+				trusted = append(trusted, key)
+			}
+		}
+	}
+	return trusted
+}
+
+// splitRRsets groups records (excluding RRSIG and OPT) into RRsets by owner name and type.
+func splitRRsets(rrs []dns.RR) [][]dns.RR {
+	var sets [][]dns.RR
+	index := make(map[string]int)
+	for _, rr := range rrs {
+		header := rr.Header()
+		if header.Rrtype == dns.TypeRRSIG || header.Rrtype == dns.TypeOPT {
+			continue
+		}
+		key := dns.CanonicalName(header.Name) + "/" + dns.TypeToString[header.Rrtype]
+		if i, ok := index[key]; ok {
+			sets[i] = append(sets[i], rr)
+			continue
+		}
+		index[key] = len(sets)
+		sets = append(sets, []dns.RR{rr})
+	}
+	return sets
+}
+
+// coveringSignatures returns the RRSIGs in rrs covering the RRset name/rrtype.
+func coveringSignatures(rrs []dns.RR, name string, rrtype uint16) []*dns.RRSIG {
+	var sigs []*dns.RRSIG
+	for _, sig := range signaturesIn(rrs) {
+		if sig.TypeCovered == rrtype && dns.CanonicalName(sig.Hdr.Name) == dns.CanonicalName(name) {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// signaturesIn returns every RRSIG in rrs.
+func signaturesIn(rrs []dns.RR) []*dns.RRSIG {
+	var sigs []*dns.RRSIG
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// parentZone strips the leftmost label of a zone name.
+func parentZone(zone string) string {
+	labels := dns.SplitDomainName(zone)
+	if len(labels) <= 1 {
+		return "."
+	}
+	return dns.Fqdn(strings.Join(labels[1:], "."))
+}
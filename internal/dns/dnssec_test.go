@@ -0,0 +1,247 @@
+package dns
+
+import (
+	"context"
+	"crypto"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+)
+
+// testZone is a zone of the in-process test server, signed with a single key unless key is nil.
+type testZone struct {
+	name string
+	key  *dns.DNSKEY
+	priv crypto.Signer
+	soa  dns.RR
+}
+
+// testServer is an authoritative server for a set of zones, serving their records and signatures.
+type testServer struct {
+	t       *testing.T
+	zones   map[string]*testZone
+	records map[string][]dns.RR // by canonical name and type, RRSIGs included
+}
+
+func newTestServer(t *testing.T) *testServer {
+	return &testServer{t: t, zones: make(map[string]*testZone), records: make(map[string][]dns.RR)}
+}
+
+func recordKey(name string, rrtype uint16) string {
+	return dns.CanonicalName(name) + "/" + dns.TypeToString[rrtype]
+}
+
+// addZone creates a zone with its SOA, and a key and a signed DNSKEY RRset when signed is set.
+func (s *testServer) addZone(name string, signed bool) *testZone {
+	zone := &testZone{name: name, soa: s.rr(name + " 3600 IN SOA ns." + name + " hostmaster." + name + " 1 3600 600 86400 300")}
+	s.zones[name] = zone
+	if signed {
+		zone.key = &dns.DNSKEY{
+			Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+			Flags:     257,
+			Protocol:  3,
+			Algorithm: dns.ECDSAP256SHA256,
+		}
+		priv, err := zone.key.Generate(256)
+		if err != nil {
+			s.t.Fatalf("generating key for %s: %v", name, err)
+		}
+		zone.priv = priv.(crypto.Signer)
+		s.add(zone, zone.key)
+	}
+	s.add(zone, zone.soa)
+	return zone
+}
+
+// add stores an RRset, signed by signer's key if it has one.
+func (s *testServer) add(signer *testZone, rrs ...dns.RR) {
+	header := rrs[0].Header()
+	key := recordKey(header.Name, header.Rrtype)
+	s.records[key] = append(s.records[key], rrs...)
+	if signer != nil && signer.key != nil {
+		s.records[key] = append(s.records[key], s.sign(signer, rrs))
+	}
+}
+
+// sign returns an RRSIG over rrs made with the zone's key.
+func (s *testServer) sign(zone *testZone, rrs []dns.RR) *dns.RRSIG {
+	header := rrs[0].Header()
+	sig := &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: header.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: header.Ttl},
+		TypeCovered: header.Rrtype,
+		Algorithm:   zone.key.Algorithm,
+		Labels:      uint8(dns.CountLabel(header.Name)),
+		OrigTtl:     header.Ttl,
+		Expiration:  uint32(time.Now().Add(24 * time.Hour).Unix()),
+		Inception:   uint32(time.Now().Add(-time.Hour).Unix()),
+		KeyTag:      zone.key.KeyTag(),
+		SignerName:  zone.name,
+	}
+	if err := sig.Sign(zone.priv, rrs); err != nil {
+		s.t.Fatalf("signing %s: %v", header.Name, err)
+	}
+	return sig
+}
+
+// delegate publishes child's DS record, signed by signer (normally the parent zone).
+func (s *testServer) delegate(signer, child *testZone) {
+	s.add(signer, child.key.ToDS(dns.SHA256))
+}
+
+func (s *testServer) rr(text string) dns.RR {
+	rr, err := dns.NewRR(text)
+	if err != nil {
+		s.t.Fatalf("parsing %q: %v", text, err)
+	}
+	return rr
+}
+
+// enclosingZone returns the closest zone containing name.
+func (s *testServer) enclosingZone(name string) *testZone {
+	for name = dns.CanonicalName(name); ; name = parentZone(name) {
+		if zone, ok := s.zones[name]; ok {
+			return zone
+		}
+		if name == "." {
+			return nil
+		}
+	}
+}
+
+func (s *testServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.SetEdns0(dns.DefaultMsgSize, true)
+
+	q := r.Question[0]
+	if rrs, ok := s.records[recordKey(q.Name, q.Qtype)]; ok {
+		m.Answer = rrs
+	} else {
+		// NODATA from the enclosing zone; DS queries are answered by the parent
+		name := q.Name
+		if q.Qtype == dns.TypeDS {
+			name = parentZone(name)
+		}
+		if zone := s.enclosingZone(name); zone != nil {
+			m.Ns = append(m.Ns, s.records[recordKey(zone.name, dns.TypeSOA)]...)
+		}
+		m.Ns = append(m.Ns, s.records[recordKey(q.Name, dns.TypeNSEC)]...)
+	}
+	w.WriteMsg(m)
+}
+
+// start serves the zones on a local UDP port and returns a server configured to validate against
+// the keys of the anchor zones.
+func (s *testServer) start(anchors ...*testZone) types.Server {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		s.t.Fatalf("listening: %v", err)
+	}
+	srv := &dns.Server{PacketConn: conn, Handler: s}
+	go srv.ActivateAndServe()
+	s.t.Cleanup(func() { srv.Shutdown() })
+
+	var trustAnchors []string
+	for _, zone := range anchors {
+		trustAnchors = append(trustAnchors, zone.key.String())
+	}
+	return types.Server{
+		Name:    "test",
+		Address: conn.LocalAddr().String(),
+		Timeout: types.Duration(2 * time.Second),
+		DNSSEC:  &types.DNSSECOptions{Validate: true, TrustAnchors: trustAnchors},
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	s := newTestServer(t)
+	example := s.addZone("example.", true)
+	evil := s.addZone("evil.", true)
+
+	// secure.example. has a trusted DS in example.
+	secure := s.addZone("secure.example.", true)
+	s.delegate(example, secure)
+	s.add(secure, s.rr("www.secure.example. 300 IN A 192.0.2.1"))
+
+	s.add(example, s.rr("www.example. 300 IN A 192.0.2.1"))
+
+	// The signature covers a different address than the one served
+	tampered := s.rr("tampered.example. 300 IN A 192.0.2.1")
+	sig := s.sign(example, []dns.RR{tampered})
+	s.records[recordKey("tampered.example.", dns.TypeA)] = []dns.RR{s.rr("tampered.example. 300 IN A 192.0.2.66"), sig}
+
+	// A trusted zone signing data of another zone
+	s.add(evil, s.rr("www.bank.example. 300 IN A 192.0.2.66"))
+
+	// A parent zone signing data below its secure delegation
+	s.add(example, s.rr("www2.secure.example. 300 IN A 192.0.2.66"))
+
+	// A valid signature and an injected one whose signer is the owner name, which is not a zone
+	injected := &testZone{name: "injected.example."}
+	injected.key = &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: injected.name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     256,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := injected.key.Generate(256)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	injected.priv = priv.(crypto.Signer)
+	signed := s.rr("injected.example. 300 IN A 192.0.2.1")
+	s.records[recordKey("injected.example.", dns.TypeA)] = []dns.RR{
+		signed, s.sign(injected, []dns.RR{signed}), s.sign(example, []dns.RR{signed}),
+	}
+
+	// hijacked.example. has a DS signed by evil. instead of its parent
+	hijacked := s.addZone("hijacked.example.", true)
+	s.delegate(evil, hijacked)
+	s.add(hijacked, s.rr("www.hijacked.example. 300 IN A 192.0.2.66"))
+
+	// unsigned.example. is delegated without a DS, which the signed NSEC of example. proves
+	s.addZone("unsigned.example.", false)
+	s.add(example, s.rr("unsigned.example. 3600 IN NSEC www.example. NS RRSIG NSEC"))
+	s.add(nil, s.rr("www.unsigned.example. 300 IN A 192.0.2.1"))
+
+	// Unsigned data in a signed zone
+	s.add(nil, s.rr("unsigned-rr.example. 300 IN A 192.0.2.1"))
+
+	server := s.start(example, evil)
+
+	tests := []struct {
+		name   string
+		status string
+		reason string
+	}{
+		{"www.example.", types.DNSSECSecure, ""},
+		{"www.secure.example.", types.DNSSECSecure, ""},
+		{"tampered.example.", types.DNSSECBogus, "verifies"},
+		{"www.bank.example.", types.DNSSECBogus, "not its zone example."},
+		{"www2.secure.example.", types.DNSSECBogus, "not its zone secure.example."},
+		{"injected.example.", types.DNSSECSecure, ""},
+		{"www.hijacked.example.", types.DNSSECBogus, "not its parent zone example."},
+		{"unsigned-rr.example.", types.DNSSECBogus, "no RRSIG"},
+		{"www.unsigned.example.", types.DNSSECInsecure, "unsigned zone"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := Query(context.Background(), server, test.name, "udp", "A")
+			if !result.Success {
+				t.Fatalf("query failed: %s", result.Error)
+			}
+			if result.DNSSECStatus != test.status {
+				t.Errorf("status %q (%s), want %q", result.DNSSECStatus, result.DNSSECReason, test.status)
+			}
+			if !strings.Contains(result.DNSSECReason, test.reason) {
+				t.Errorf("reason %q, want it to contain %q", result.DNSSECReason, test.reason)
+			}
+		})
+	}
+}
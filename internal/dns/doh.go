@@ -0,0 +1,240 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+)
+
+func init() {
+	Register("doh", dohTransport{})
+}
+
+// maxDoHResponseSize bounds how much of a DoH response body is read.
+const maxDoHResponseSize = 65535
+
+// dohTransport performs DNS-over-HTTPS using net/http.
+// Automatically constructs the DoH URL: adds https:// prefix if missing and appends /dns-query if needed.
+// By default sends the DNS message as a binary POST (RFC 8484, application/dns-message). The server's
+// doh options select GET with a base64url dns= parameter, a fixed HTTP version, or the JSON API
+// (application/dns-json), which is the default for /resolve URLs.
+type dohTransport struct{}
+
+func (dohTransport) Exchange(ctx context.Context, server types.Server, msg *dns.Msg) (*dns.Msg, error) {
+	url := dohURL(server.Address)
+	client := dohClient(server)
+
+	if dohFormat(server.DoH, url) == types.DoHFormatJSON {
+		return exchangeDoHJSON(ctx, client, url, msg)
+	}
+
+	// RFC 8484 §4.1: use a DNS ID of 0 to maximise HTTP cache friendliness.
+	query := msg.Copy()
+	query.Id = 0
+	buf, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack DNS message: %w", err)
+	}
+
+	var req *http.Request
+	if strings.EqualFold(server.DoH.Method, types.DoHMethodGet) {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, withQuery(url, "dns="+base64.RawURLEncoding.EncodeToString(buf)), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(buf))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	if req.Method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/dns-message")
+	}
+	req.Header.Set("Accept", "application/dns-message")
+
+	respBuf, err := doHTTP(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	response := new(dns.Msg)
+	if err := response.Unpack(respBuf); err != nil {
+		return nil, fmt.Errorf("failed to unpack DNS response: %w", err)
+	}
+	ContextTrace(ctx).ResponseSize = len(respBuf)
+	response.Id = msg.Id
+	return response, nil
+}
+
+// doHTTP sends req, records the connection phases, HTTP round trip, negotiated HTTP version and status
+// in the context Trace, and returns the body of a 200 response. Connection phases are only recorded
+// when the request opens a new connection rather than reusing a pooled one. The phases are recorded
+// for failed requests and error statuses too, with the HTTP phase lasting until the failure.
+func doHTTP(ctx context.Context, client *http.Client, req *http.Request) ([]byte, error) {
+	trace := ContextTrace(ctx)
+	phases := &httpPhases{}
+	defer func() {
+		phases.done()
+		phases.copyTo(trace)
+	}()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), phases.clientTrace()))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	trace.HTTPVersion = resp.Proto
+	trace.HTTPStatus = resp.StatusCode
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP request failed with status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDoHResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return body, nil
+}
+
+// httpPhases collects connection and request timings from httptrace callbacks. Dial callbacks can run
+// on the transport's dialing goroutine, possibly after the request has moved on, so access is locked.
+type httpPhases struct {
+	mu                                        sync.Mutex
+	dnsStart, connectStart, tlsStart, gotConn time.Time
+	dnsLookup, connect, tlsHandshake, http    time.Duration
+}
+
+// clientTrace returns the httptrace hooks that record into p.
+func (p *httpPhases) clientTrace() *httptrace.ClientTrace {
+	record := func(f func()) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		f()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { record(func() { p.dnsStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { record(func() { p.dnsLookup = time.Since(p.dnsStart) }) },
+		ConnectStart: func(string, string) {
+			record(func() {
+				if p.connectStart.IsZero() {
+					p.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone:       func(string, string, error) { record(func() { p.connect = time.Since(p.connectStart) }) },
+		TLSHandshakeStart: func() { record(func() { p.tlsStart = time.Now() }) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { record(func() { p.tlsHandshake = time.Since(p.tlsStart) }) },
+		GotConn:           func(httptrace.GotConnInfo) { record(func() { p.gotConn = time.Now() }) },
+	}
+}
+
+// done records the HTTP round trip from obtaining the connection until now.
+func (p *httpPhases) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.gotConn.IsZero() {
+		p.http = time.Since(p.gotConn)
+	}
+}
+
+// copyTo stores the recorded phases in trace.
+func (p *httpPhases) copyTo(trace *Trace) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	trace.DNSLookup = p.dnsLookup
+	trace.Connect = p.connect
+	trace.TLSHandshake = p.tlsHandshake
+	trace.HTTP = p.http
+}
+
+// dohURL adds an https:// prefix if missing and appends /dns-query unless a path is already present.
+func dohURL(address string) string {
+	url := address
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "https://" + url
+	}
+	if !strings.Contains(url, "/dns-query") && !strings.Contains(url, "/resolve") {
+		if !strings.HasSuffix(url, "/") {
+			url += "/"
+		}
+		url += "dns-query"
+	}
+	return url
+}
+
+// dohFormat returns the configured message format, defaulting to JSON for /resolve endpoints.
+func dohFormat(options types.DoHOptions, url string) string {
+	if options.Format != "" {
+		return strings.ToLower(options.Format)
+	}
+	if strings.Contains(url, "/resolve") {
+		return types.DoHFormatJSON
+	}
+	return types.DoHFormatWire
+}
+
+// withQuery appends a query string parameter to url.
+func withQuery(url string, param string) string {
+	if strings.Contains(url, "?") {
+		return url + "&" + param
+	}
+	return url + "?" + param
+}
+
+// dohClientKey identifies the settings an HTTP client was built for.
+type dohClientKey struct {
+	httpVersion string
+	serverName  string
+	insecure    bool
+}
+
+// dohClients caches one HTTP client per distinct setting so connections are pooled as with
+// http.DefaultClient.
+var dohClients sync.Map
+
+// dohClient returns an HTTP client restricted to the server's configured HTTP version.
+func dohClient(server types.Server) *http.Client {
+	key := dohClientKey{
+		httpVersion: server.DoH.HTTPVersion,
+		serverName:  server.TLSServerName,
+		insecure:    server.TLSInsecureSkipVerify,
+	}
+	if client, ok := dohClients.Load(key); ok {
+		return client.(*http.Client)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		ServerName:         key.serverName,
+		InsecureSkipVerify: key.insecure,
+	}
+
+	protocols := new(http.Protocols)
+	switch key.httpVersion {
+	case types.HTTPVersion1:
+		protocols.SetHTTP1(true)
+	case types.HTTPVersion2:
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	default:
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	}
+	transport.Protocols = protocols
+
+	client, _ := dohClients.LoadOrStore(key, &http.Client{Transport: transport})
+	return client.(*http.Client)
+}
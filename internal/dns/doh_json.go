@@ -0,0 +1,114 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+// dohJSONResponse is the application/dns-json response format used by the Google and Cloudflare
+// JSON APIs.
+type dohJSONResponse struct {
+	Status     int
+	TC         bool
+	RD         bool
+	RA         bool
+	AD         bool
+	CD         bool
+	Answer     []dohJSONRecord
+	Authority  []dohJSONRecord
+	Additional []dohJSONRecord
+}
+
+// dohJSONRecord is a single record in a JSON API response.
+type dohJSONRecord struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// exchangeDoHJSON queries a JSON API endpoint with GET ?name=&type= and converts the response
+// into a *dns.Msg so it can be handled like any other transport's reply. The CD and DO bits and the
+// EDNS Client Subnet of msg are sent as the cd, do and edns_client_subnet parameters.
+func exchangeDoHJSON(ctx context.Context, client *http.Client, endpoint string, msg *dns.Msg) (*dns.Msg, error) {
+	question := msg.Question[0]
+	params := url.Values{}
+	params.Set("name", question.Name)
+	params.Set("type", strconv.Itoa(int(question.Qtype)))
+	if msg.CheckingDisabled {
+		params.Set("cd", "1")
+	}
+	if opt := msg.IsEdns0(); opt != nil {
+		if opt.Do() {
+			params.Set("do", "1")
+		}
+		for _, option := range opt.Option {
+			if subnet, ok := option.(*dns.EDNS0_SUBNET); ok {
+				params.Set("edns_client_subnet", fmt.Sprintf("%s/%d", subnet.Address, subnet.SourceNetmask))
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, withQuery(endpoint, params.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	body, err := doHTTP(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded dohJSONResponse
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(msg)
+	response.Rcode = decoded.Status
+	response.Truncated = decoded.TC
+	response.RecursionDesired = decoded.RD
+	response.RecursionAvailable = decoded.RA
+	response.AuthenticatedData = decoded.AD
+	response.CheckingDisabled = decoded.CD
+
+	sections := []struct {
+		records []dohJSONRecord
+		rrs     *[]dns.RR
+	}{
+		{decoded.Answer, &response.Answer},
+		{decoded.Authority, &response.Ns},
+		{decoded.Additional, &response.Extra},
+	}
+	for _, section := range sections {
+		for _, record := range section.records {
+			rr, err := jsonRecordToRR(record)
+			if err != nil {
+				return nil, err
+			}
+			*section.rrs = append(*section.rrs, rr)
+		}
+	}
+	return response, nil
+}
+
+// jsonRecordToRR parses a JSON API record by rendering it in zone-file presentation format.
+func jsonRecordToRR(record dohJSONRecord) (dns.RR, error) {
+	rrType, ok := dns.TypeToString[record.Type]
+	if !ok {
+		rrType = fmt.Sprintf("TYPE%d", record.Type)
+	}
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(record.Name), record.TTL, rrType, record.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON %s record %q: %w", rrType, record.Data, err)
+	}
+	return rr, nil
+}
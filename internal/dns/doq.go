@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+func init() {
+	Register("doq", doqTransport{})
+}
+
+// doqNoError is the DOQ_NO_ERROR application error code used to close connections (RFC 9250 §4.3).
+const doqNoError = 0
+
+// doqTransport performs DNS-over-QUIC (RFC 9250, port 853) using github.com/quic-go/quic-go.
+// Each query is sent on its own bidirectional stream with a 2-byte length prefix and a message ID of 0.
+// The QUIC handshake, which includes the TLS handshake, is recorded as the TLS phase of the context Trace.
+// Sessions keep the QUIC connection open and open a new stream per query.
+type doqTransport struct{}
+
+func (t doqTransport) Exchange(ctx context.Context, server types.Server, msg *dns.Msg) (*dns.Msg, error) {
+	return exchangeOnce(ctx, t, server, msg)
+}
+
+func (doqTransport) Open(ctx context.Context, server types.Server) (Session, error) {
+	address, err := resolveServer(ctx, withDefaultPort(server.Address, "853"))
+	if err != nil {
+		return nil, err
+	}
+
+	handshakeStart := time.Now()
+	conn, err := quic.DialAddr(ctx, address, tlsConfig(server, "doq"), nil)
+	ContextTrace(ctx).TLSHandshake = time.Since(handshakeStart)
+	if err != nil {
+		return nil, fmt.Errorf("QUIC handshake failed: %w", err)
+	}
+	return &doqSession{conn: conn}, nil
+}
+
+// doqSession sends each query on a new stream of one QUIC connection.
+type doqSession struct {
+	conn *quic.Conn
+}
+
+func (s *doqSession) Exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	exchangeStart := time.Now()
+	defer func() { ContextTrace(ctx).Exchange = time.Since(exchangeStart) }()
+
+	stream, err := s.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open QUIC stream: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+
+	// RFC 9250 §4.2.1: the DNS Message ID MUST be set to 0 on DoQ.
+	query := msg.Copy()
+	query.Id = 0
+	buf, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack DNS message: %w", err)
+	}
+
+	framed := make([]byte, 2+len(buf))
+	binary.BigEndian.PutUint16(framed, uint16(len(buf)))
+	copy(framed[2:], buf)
+	if _, err := stream.Write(framed); err != nil {
+		return nil, fmt.Errorf("failed to write query: %w", err)
+	}
+	// Closing the send side signals that no further queries follow on this stream.
+	if err := stream.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close query stream: %w", err)
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(stream, length[:]); err != nil {
+		return nil, fmt.Errorf("failed to read response length: %w", err)
+	}
+	respBuf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(stream, respBuf); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	response := new(dns.Msg)
+	if err := response.Unpack(respBuf); err != nil {
+		return nil, fmt.Errorf("failed to unpack DNS response: %w", err)
+	}
+	ContextTrace(ctx).ResponseSize = len(respBuf)
+	response.Id = msg.Id
+	return response, nil
+}
+
+func (s *doqSession) Close() error {
+	return s.conn.CloseWithError(doqNoError, "")
+}
@@ -0,0 +1,157 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// selfSignedCertificate returns a self-signed certificate for localhost.
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serveDoQ answers every query on a local DoQ listener with an A record, until the test ends. It
+// returns the listener address, a channel receiving the ID of each query and the number of
+// connections accepted.
+func serveDoQ(t *testing.T) (string, <-chan uint16, *atomic.Int32) {
+	t.Helper()
+	tlsConf := &tls.Config{Certificates: []tls.Certificate{selfSignedCertificate(t)}, NextProtos: []string{"doq"}}
+	listener, err := quic.ListenAddr("127.0.0.1:0", tlsConf, nil)
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	ids := make(chan uint16, 16)
+	conns := new(atomic.Int32)
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					go answerDoQ(stream, ids)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), ids, conns
+}
+
+// answerDoQ reads one length-prefixed query from stream and writes the answer.
+func answerDoQ(stream *quic.Stream, ids chan<- uint16) {
+	defer stream.Close()
+	var length [2]byte
+	if _, err := io.ReadFull(stream, length[:]); err != nil {
+		return
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		return
+	}
+	query := new(dns.Msg)
+	if err := query.Unpack(buf); err != nil {
+		return
+	}
+	ids <- query.Id
+
+	m := new(dns.Msg)
+	m.SetReply(query)
+	rr, _ := dns.NewRR(query.Question[0].Name + " 60 IN A 192.0.2.53")
+	m.Answer = append(m.Answer, rr)
+	packed, err := m.Pack()
+	if err != nil {
+		return
+	}
+	framed := make([]byte, 2+len(packed))
+	binary.BigEndian.PutUint16(framed, uint16(len(packed)))
+	copy(framed[2:], packed)
+	stream.Write(framed)
+}
+
+func TestDoQQuery(t *testing.T) {
+	address, ids, _ := serveDoQ(t)
+	server := types.Server{
+		Name:                  "doq",
+		Address:               address,
+		Timeout:               types.Duration(5 * time.Second),
+		TLSInsecureSkipVerify: true,
+	}
+
+	result := Query(context.Background(), server, "example.test", "doq", "A")
+	if !result.Success {
+		t.Fatalf("query failed: %s", result.Error)
+	}
+	if len(result.ResponseIPs) != 1 || result.ResponseIPs[0] != "192.0.2.53" {
+		t.Errorf("response IPs %v, want [192.0.2.53]", result.ResponseIPs)
+	}
+	if id := <-ids; id != 0 {
+		t.Errorf("query sent with message ID %d, want 0 (RFC 9250 section 4.2.1)", id)
+	}
+	if result.Timing.TLSHandshake <= 0 {
+		t.Errorf("QUIC handshake not timed")
+	}
+}
+
+func TestDoQSessionReusesConnection(t *testing.T) {
+	address, _, conns := serveDoQ(t)
+	server := types.Server{Address: address, TLSInsecureSkipVerify: true}
+
+	session, err := doqTransport{}.Open(context.Background(), server)
+	if err != nil {
+		t.Fatalf("opening session: %v", err)
+	}
+	defer session.Close()
+
+	for i := 0; i < 3; i++ {
+		msg := new(dns.Msg)
+		msg.SetQuestion("example.test.", dns.TypeA)
+		r, err := session.Exchange(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+		if r.Id != msg.Id {
+			t.Errorf("query %d: response ID %d, want the query's ID %d", i, r.Id, msg.Id)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("%d connections accepted, want 1", n)
+	}
+}
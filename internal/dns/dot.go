@@ -0,0 +1,45 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+)
+
+func init() {
+	Register("dot", dotTransport{})
+}
+
+// dotTransport performs DNS-over-TLS (port 853). Uses github.com/miekg/dns over a crypto/tls connection,
+// so the TCP connect and TLS handshake are timed separately. Defaults to port 853 if no port is specified.
+// TLS ServerName is taken from tls_server_name or the address hostname. No ALPN protocol is offered, as
+// servers that do not know "dot" may reject the handshake. Sessions keep the TLS connection open and
+// send queries on it one at a time.
+type dotTransport struct{}
+
+func (t dotTransport) Exchange(ctx context.Context, server types.Server, msg *dns.Msg) (*dns.Msg, error) {
+	return exchangeOnce(ctx, t, server, msg)
+}
+
+func (dotTransport) Open(ctx context.Context, server types.Server) (Session, error) {
+	conn, err := dialServer(ctx, "tcp", withDefaultPort(server.Address, "853"))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig(server))
+	start := time.Now()
+	err = tlsConn.HandshakeContext(ctx)
+	ContextTrace(ctx).TLSHandshake = time.Since(start)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+
+	return &connSession{network: "tcp-tls", conn: tlsConn}, nil
+}
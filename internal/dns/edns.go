@@ -0,0 +1,238 @@
+package dns
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"unicode"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+)
+
+// queryPaddingBlock is the block size queries are padded to, as RFC 8467 recommends for clients.
+const queryPaddingBlock = 128
+
+// paddedProtocols are the encrypted protocols whose responses are checked for padding.
+var paddedProtocols = map[string]bool{"dot": true, "doh": true, "doq": true}
+
+// ednsOptionNames names the option codes of response OPT records.
+var ednsOptionNames = map[uint16]string{
+	dns.EDNS0LLQ:          "LLQ",
+	dns.EDNS0UL:           "UL",
+	dns.EDNS0NSID:         "NSID",
+	dns.EDNS0DAU:          "DAU",
+	dns.EDNS0DHU:          "DHU",
+	dns.EDNS0N3U:          "N3U",
+	dns.EDNS0SUBNET:       "ECS",
+	dns.EDNS0EXPIRE:       "EXPIRE",
+	dns.EDNS0COOKIE:       "COOKIE",
+	dns.EDNS0TCPKEEPALIVE: "TCP-KEEPALIVE",
+	dns.EDNS0PADDING:      "PADDING",
+	dns.EDNS0EDE:          "EDE",
+}
+
+// ParseClientSubnet parses an EDNS Client Subnet prefix such as "198.51.100.0/24" or "2001:db8::/56".
+// A plain address is a full-length prefix.
+func ParseClientSubnet(prefix string) (*dns.EDNS0_SUBNET, error) {
+	if !strings.Contains(prefix, "/") {
+		ip := net.ParseIP(prefix)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid client subnet '%s'", prefix)
+		}
+		if ip.To4() != nil {
+			prefix += "/32"
+		} else {
+			prefix += "/128"
+		}
+	}
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client subnet '%s'", prefix)
+	}
+
+	bits, _ := network.Mask.Size()
+	subnet := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        2,
+		SourceNetmask: uint8(bits),
+		Address:       network.IP,
+	}
+	if ip4 := network.IP.To4(); ip4 != nil {
+		subnet.Family = 1
+		subnet.Address = ip4
+	}
+	return subnet, nil
+}
+
+// applyEDNSOptions adds an OPT record with the requested options to msg, or completes the one the
+// DNSSEC options added. Padding is added last so it can round the whole message up to a block.
+func applyEDNSOptions(msg *dns.Msg, options *types.EDNSOptions) error {
+	if options == nil {
+		return nil
+	}
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(dns.DefaultMsgSize, false)
+		opt = msg.IsEdns0()
+	}
+	if options.UDPSize > 0 {
+		opt.SetUDPSize(options.UDPSize)
+	}
+
+	if options.ClientSubnet != "" {
+		subnet, err := ParseClientSubnet(options.ClientSubnet)
+		if err != nil {
+			return err
+		}
+		opt.Option = append(opt.Option, subnet)
+	}
+	if options.NSID {
+		opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+	}
+	if options.Cookie {
+		cookie := make([]byte, 8)
+		if _, err := rand.Read(cookie); err != nil {
+			return fmt.Errorf("failed to generate client cookie: %w", err)
+		}
+		opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: hex.EncodeToString(cookie)})
+	}
+	if options.Padding {
+		padding := &dns.EDNS0_PADDING{}
+		opt.Option = append(opt.Option, padding)
+		if remainder := msg.Len() % queryPaddingBlock; remainder != 0 {
+			padding.Padding = make([]byte, queryPaddingBlock-remainder)
+		}
+	}
+	return nil
+}
+
+// collectEDNS describes the OPT record of a response and the options it carries, or returns nil if
+// the response has none.
+func collectEDNS(r *dns.Msg) *types.EDNS {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	edns := &types.EDNS{
+		Version: opt.Version(),
+		UDPSize: opt.UDPSize(),
+		DO:      opt.Do(),
+		Options: []types.EDNSOption{},
+	}
+	for _, option := range opt.Option {
+		name, ok := ednsOptionNames[option.Option()]
+		if !ok {
+			name = fmt.Sprintf("OPT%d", option.Option())
+		}
+		data := option.String()
+
+		switch o := option.(type) {
+		case *dns.EDNS0_NSID:
+			edns.NSID = decodeNSID(o.Nsid)
+			data = edns.NSID
+		case *dns.EDNS0_SUBNET:
+			edns.ClientSubnet = fmt.Sprintf("%s/%d/%d", o.Address, o.SourceNetmask, o.SourceScope)
+			data = edns.ClientSubnet
+		case *dns.EDNS0_COOKIE:
+			if len(o.Cookie) > 16 {
+				edns.ServerCookie = o.Cookie[16:]
+			}
+		case *dns.EDNS0_PADDING:
+			edns.Padding = len(o.Padding)
+			data = fmt.Sprintf("%d bytes", edns.Padding)
+		}
+		edns.Options = append(edns.Options, types.EDNSOption{Code: option.Option(), Name: name, Data: data})
+	}
+	return edns
+}
+
+// extendedErrors returns the Extended DNS Error options of a response, in order.
+func extendedErrors(r *dns.Msg) []types.ExtendedError {
+	extended := []types.ExtendedError{}
+	if opt := r.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if ede, ok := option.(*dns.EDNS0_EDE); ok {
+				extended = append(extended, types.ExtendedError{
+					InfoCode:  ede.InfoCode,
+					Name:      dns.ExtendedErrorCodeToString[ede.InfoCode],
+					ExtraText: ede.ExtraText,
+				})
+			}
+		}
+	}
+	return extended
+}
+
+// decodeNSID returns a hex-encoded NSID as text when it is printable, and as hex otherwise.
+func decodeNSID(nsid string) string {
+	decoded, err := hex.DecodeString(nsid)
+	if err != nil || len(decoded) == 0 {
+		return nsid
+	}
+	for _, r := range string(decoded) {
+		if !unicode.IsPrint(r) {
+			return nsid
+		}
+	}
+	return string(decoded)
+}
+
+// checkEDNS verifies the cookie and padding of a response to a query sent with those options.
+func checkEDNS(query, r *dns.Msg, protocol string, options *types.EDNSOptions, result *types.QueryResult) {
+	if options == nil {
+		return
+	}
+	if options.Cookie {
+		result.CookieStatus = cookieStatus(query, r)
+	}
+	if options.Padding && paddedProtocols[protocol] {
+		result.PaddingStatus = types.Unpadded
+		if result.EDNS != nil && optionIn(r.IsEdns0(), dns.EDNS0PADDING) {
+			result.PaddingStatus = types.Padded
+		}
+	}
+}
+
+// cookieStatus checks that a response echoes the client cookie of the query and adds a server cookie
+// of 8 to 32 bytes (RFC 7873).
+func cookieStatus(query, r *dns.Msg) string {
+	sent, received := cookieOf(query), cookieOf(r)
+	switch {
+	case received == "":
+		return types.CookieMissing
+	case len(received) < 16 || !strings.EqualFold(received[:16], sent[:16]):
+		return types.CookieMismatch
+	case len(received) < 16+16 || len(received) > 16+64:
+		return types.CookieMalformed
+	}
+	return types.CookieValid
+}
+
+// cookieOf returns the hex-encoded cookie option of a message, or "".
+func cookieOf(msg *dns.Msg) string {
+	if opt := msg.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if cookie, ok := option.(*dns.EDNS0_COOKIE); ok {
+				return cookie.Cookie
+			}
+		}
+	}
+	return ""
+}
+
+// optionIn reports whether an OPT record carries an option with the given code.
+func optionIn(opt *dns.OPT, code uint16) bool {
+	if opt == nil {
+		return false
+	}
+	for _, option := range opt.Option {
+		if option.Option() == code {
+			return true
+		}
+	}
+	return false
+}
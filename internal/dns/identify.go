@@ -0,0 +1,114 @@
+package dns
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+)
+
+// instanceNames are the CHAOS TXT names servers answer with their instance identifier, in the order
+// they are tried.
+var instanceNames = []string{types.InstanceIDServer, types.InstanceHostnameBind}
+
+// probeTimeout bounds each CHAOS TXT probe. Many servers silently drop CHAOS queries, so waiting the
+// full server timeout would only delay the results.
+const probeTimeout = 2 * time.Second
+
+// Instances caches the CHAOS TXT identity of each server and protocol, so a run probes a server once
+// rather than after every response without an NSID. It is safe for concurrent use.
+type Instances struct {
+	mu     sync.Mutex
+	probes map[string]*instanceProbe
+}
+
+// instanceProbe is the outcome of probing one server over one protocol, computed once.
+type instanceProbe struct {
+	once           sync.Once
+	instance       string
+	instanceSource string
+}
+
+// NewInstances returns an empty cache, typically one per run.
+func NewInstances() *Instances {
+	return &Instances{probes: make(map[string]*instanceProbe)}
+}
+
+type instancesKey struct{}
+
+// WithInstances returns a context whose queries share the probes cached in instances. Without one,
+// every query that needs a probe sends its own.
+func WithInstances(ctx context.Context, instances *Instances) context.Context {
+	return context.WithValue(ctx, instancesKey{}, instances)
+}
+
+// probe returns the cached identity of server over protocol, probing it on first use. Concurrent
+// callers for the same server and protocol wait for the one probe.
+func (c *Instances) probe(ctx context.Context, transport Transport, server types.Server, protocol string) (string, string) {
+	key := server.Name + "|" + server.Address + "|" + protocol
+	c.mu.Lock()
+	p, ok := c.probes[key]
+	if !ok {
+		p = &instanceProbe{}
+		c.probes[key] = p
+	}
+	c.mu.Unlock()
+
+	p.once.Do(func() {
+		p.instance, p.instanceSource = probeInstance(ctx, transport, server)
+	})
+	return p.instance, p.instanceSource
+}
+
+// identifyInstance records which instance of a server answered a query: the NSID of the response if
+// it has one, or else the answer to a CHAOS TXT probe sent over the same protocol. The probe is sent
+// once per server and protocol for the Instances of ctx, so it identifies the instance that answered
+// the probe, which is only the one that answered the query while routing does not change.
+func identifyInstance(ctx context.Context, transport Transport, server types.Server, protocol string, result *types.QueryResult) {
+	if result.EDNS != nil && result.EDNS.NSID != "" {
+		result.Instance, result.InstanceSource = result.EDNS.NSID, types.InstanceNSID
+		return
+	}
+	if instances, ok := ctx.Value(instancesKey{}).(*Instances); ok {
+		result.Instance, result.InstanceSource = instances.probe(ctx, transport, server, protocol)
+		return
+	}
+	result.Instance, result.InstanceSource = probeInstance(ctx, transport, server)
+}
+
+// probeInstance sends the CHAOS TXT probes in turn and returns the first identifier and the name that
+// returned it, or InstanceUnidentified if none is answered.
+func probeInstance(ctx context.Context, transport Transport, server types.Server) (string, string) {
+	for _, name := range instanceNames {
+		if id := chaosTXT(ctx, transport, server, name); id != "" {
+			return id, name
+		}
+	}
+	return "", types.InstanceUnidentified
+}
+
+// chaosTXT returns the first TXT record of the CHAOS class answer for name, or "" if the server does
+// not answer it. The probe's timing is not recorded.
+func chaosTXT(ctx context.Context, transport Transport, server types.Server, name string) string {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), dns.TypeTXT)
+	msg.Question[0].Qclass = dns.ClassCHAOS
+
+	ctx, cancel := context.WithTimeout(ctx, min(probeTimeout, serverTimeout(server)))
+	defer cancel()
+
+	r, err := transport.Exchange(WithTrace(ctx, &Trace{}), server, msg)
+	if err != nil || r.Rcode != dns.RcodeSuccess {
+		return ""
+	}
+	for _, rr := range r.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			return strings.Join(txt.Txt, "")
+		}
+	}
+	return ""
+}
@@ -1,11 +1,8 @@
 package dns
 
 import (
-	"bytes"
-	"crypto/tls"
+	"context"
 	"fmt"
-	"net"
-	"net/http"
 	"strings"
 	"time"
 
@@ -14,226 +11,226 @@ import (
 	"github.com/miekg/dns"
 )
 
-// QueryDNS performs a DNS query using the specified protocol (udp, tcp, dot, doh).
-// Uses github.com/miekg/dns for UDP/TCP/DoT and net/http for DoH. Extracts A and AAAA records.
-// ResponseTime is measured in milliseconds.
-func QueryDNS(server types.Server, domain string, protocol string) types.QueryResult {
-	result := types.QueryResult{
-		ServerName:    server.Name,
-		ServerAddress: server.Address,
-		Domain:        domain,
-		Protocol:      protocol,
-		ResponseIPs:   []string{},
-		Success:       false,
-	}
-
-	startTime := time.Now()
+// Defaults used when a server does not configure its own timeout or retry backoff.
+const (
+	DefaultTimeout      = 10 * time.Second
+	DefaultRetryBackoff = 250 * time.Millisecond
+)
 
-	switch strings.ToLower(protocol) {
-	case "udp":
-		err := queryUDP(server.Address, domain, &result)
-		if err != nil {
-			result.Error = err.Error()
-		}
-	case "tcp":
-		err := queryTCP(server.Address, domain, &result)
-		if err != nil {
-			result.Error = err.Error()
-		}
-	case "dot":
-		err := queryDoT(server.Address, domain, &result)
-		if err != nil {
-			result.Error = err.Error()
-		}
-	case "doh":
-		err := queryDoH(server.Address, domain, &result)
-		if err != nil {
-			result.Error = err.Error()
-		}
-	default:
-		result.Error = fmt.Sprintf("unsupported protocol: %s", protocol)
+// ParseQueryType converts a record type name such as "AAAA" or "MX" to its wire value.
+func ParseQueryType(name string) (uint16, error) {
+	qtype, ok := dns.StringToType[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown query type '%s'", name)
 	}
-
-	result.ResponseTime = time.Since(startTime).Milliseconds()
-	return result
+	return qtype, nil
 }
 
-// queryUDP performs a DNS query over UDP (port 53). Uses github.com/miekg/dns.
-// Defaults to port 53 if no port is specified in the address.
-func queryUDP(address string, domain string, result *types.QueryResult) error {
-	addr := address
-	if !strings.Contains(addr, ":") {
-		addr = net.JoinHostPort(addr, "53")
-	}
-
-	client := &dns.Client{
-		Net:     "udp",
-		Timeout: 10 * time.Second,
-	}
-
-	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
-
-	r, _, err := client.Exchange(msg, addr)
+// NewQuery builds the query message for one domain and record type with the server's DNSSEC and EDNS
+// options. Queries to servers with identify request the NSID.
+func NewQuery(server types.Server, domain string, queryType string) (*dns.Msg, error) {
+	qtype, err := ParseQueryType(queryType)
 	if err != nil {
-		return err
-	}
-
-	if r.Rcode != dns.RcodeSuccess {
-		return fmt.Errorf("DNS query failed with RCODE: %d", r.Rcode)
+		return nil, err
 	}
 
-	for _, answer := range r.Answer {
-		if a, ok := answer.(*dns.A); ok {
-			result.ResponseIPs = append(result.ResponseIPs, a.A.String())
-		}
-		if aaaa, ok := answer.(*dns.AAAA); ok {
-			result.ResponseIPs = append(result.ResponseIPs, aaaa.AAAA.String())
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domain), qtype)
+	applyDNSSECOptions(msg, dnssecOptions(server))
+	edns := server.EDNS
+	if server.Identify {
+		withNSID := types.EDNSOptions{}
+		if edns != nil {
+			withNSID = *edns
 		}
+		withNSID.NSID = true
+		edns = &withNSID
 	}
+	if err := applyEDNSOptions(msg, edns); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
 
-	result.Success = true
-	return nil
+// Query performs a single query for one record type. It builds the query message, exchanges it over
+// the protocol's transport and records the response. A response is only successful if the transport
+// succeeds and the rcode is NOERROR. Each attempt is bounded by ctx and the server's timeout; transport
+// errors are retried up to the server's retry count, but DNS error responses are not.
+func Query(ctx context.Context, server types.Server, domain string, protocol string, queryType string) types.QueryResult {
+	result, _ := QueryMessage(ctx, server, domain, protocol, queryType)
+	return result
 }
 
-// queryTCP performs a DNS query over TCP (port 53). Uses github.com/miekg/dns.
-// Defaults to port 53 if no port is specified in the address.
-func queryTCP(address string, domain string, result *types.QueryResult) error {
-	addr := address
-	if !strings.Contains(addr, ":") {
-		addr = net.JoinHostPort(addr, "53")
-	}
+// QueryMessage is Query for callers that present the whole response, such as the query command. It
+// also returns the response message, or nil when no response was received.
+func QueryMessage(ctx context.Context, server types.Server, domain string, protocol string, queryType string) (types.QueryResult, *dns.Msg) {
+	result := types.QueryResult{
+		ServerName:    server.Name,
+		ServerAddress: server.Address,
+		Domain:        domain,
+		QueryType:     strings.ToUpper(queryType),
+		Protocol:      protocol,
+		Answers:       []types.Answer{},
+		ResponseIPs:   []string{},
+		Authority:     []types.Answer{},
+		Additional:    []types.Answer{},
+		Success:       false,
 
-	client := &dns.Client{
-		Net:     "tcp",
-		Timeout: 10 * time.Second,
+		ExtendedErrors: []types.ExtendedError{},
 	}
 
-	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
-
-	r, _, err := client.Exchange(msg, addr)
+	msg, err := NewQuery(server, domain, queryType)
 	if err != nil {
-		return err
-	}
-
-	if r.Rcode != dns.RcodeSuccess {
-		return fmt.Errorf("DNS query failed with RCODE: %d", r.Rcode)
+		result.Error = err.Error()
+		return result, nil
 	}
 
-	for _, answer := range r.Answer {
-		if a, ok := answer.(*dns.A); ok {
-			result.ResponseIPs = append(result.ResponseIPs, a.A.String())
-		}
-		if aaaa, ok := answer.(*dns.AAAA); ok {
-			result.ResponseIPs = append(result.ResponseIPs, aaaa.AAAA.String())
-		}
+	transport, ok := LookupTransport(protocol)
+	if !ok {
+		result.Error = fmt.Sprintf("unsupported protocol: %s", protocol)
+		return result, nil
 	}
+	dnssec := dnssecOptions(server)
 
-	result.Success = true
-	return nil
-}
-
-// queryDoT performs a DNS query over DNS-over-TLS (port 853). Uses github.com/miekg/dns with tcp-tls.
-// Defaults to port 853 if no port is specified. TLS ServerName is extracted from the address hostname.
-func queryDoT(address string, domain string, result *types.QueryResult) error {
-	addr := address
-	if !strings.Contains(addr, ":") {
-		addr = net.JoinHostPort(addr, "853")
+	r, err := exchangeWithRetry(ctx, transport, server, msg, &result)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
 	}
 
-	client := &dns.Client{
-		Net:       "tcp-tls",
-		TLSConfig: &tls.Config{ServerName: strings.Split(addr, ":")[0]},
-		Timeout:   10 * time.Second,
+	collectMetadata(r, &result)
+	checkEDNS(msg, r, protocol, server.EDNS, &result)
+	if server.Identify {
+		identifyInstance(ctx, transport, server, protocol, &result)
 	}
-
-	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
-
-	r, _, err := client.Exchange(msg, addr)
-	if err != nil {
-		return err
+	if dnssec.Validate && (r.Rcode == dns.RcodeSuccess || r.Rcode == dns.RcodeNameError) {
+		result.DNSSECStatus, result.DNSSECReason = validateResponse(ctx, transport, server, r, serverTimeout(server))
 	}
-
 	if r.Rcode != dns.RcodeSuccess {
-		return fmt.Errorf("DNS query failed with RCODE: %d", r.Rcode)
-	}
-
-	for _, answer := range r.Answer {
-		if a, ok := answer.(*dns.A); ok {
-			result.ResponseIPs = append(result.ResponseIPs, a.A.String())
-		}
-		if aaaa, ok := answer.(*dns.AAAA); ok {
-			result.ResponseIPs = append(result.ResponseIPs, aaaa.AAAA.String())
-		}
+		result.Error = errRcode(r.Rcode).Error()
+		return result, r
 	}
 
+	collectAnswers(r, &result)
 	result.Success = true
-	return nil
+	return result, r
 }
 
-// queryDoH performs a DNS query over DNS-over-HTTPS using net/http.
-// Automatically constructs the DoH URL: adds https:// prefix if missing and appends /dns-query if needed.
-// Sends DNS message as binary POST with Content-Type: application/dns-message.
-func queryDoH(address string, domain string, result *types.QueryResult) error {
-	url := address
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
-	}
-	if !strings.Contains(url, "/dns-query") && !strings.Contains(url, "/resolve") {
-		if !strings.HasSuffix(url, "/") {
-			url += "/"
+// exchangeWithRetry performs up to 1+retries attempts, waiting retry_backoff before the first retry
+// and doubling it before each further retry. It records the attempt count, the errors of failed
+// attempts, and the timing of the final attempt in result.
+func exchangeWithRetry(ctx context.Context, transport Transport, server types.Server, msg *dns.Msg, result *types.QueryResult) (*dns.Msg, error) {
+	timeout := serverTimeout(server)
+	backoff := time.Duration(server.RetryBackoff)
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	retries := 0
+	if server.Retries != nil {
+		retries = *server.Retries
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		trace := &Trace{}
+		startTime := time.Now()
+		r, err := transport.Exchange(WithTrace(attemptCtx, trace), server, msg)
+		cancel()
+
+		result.Attempts = attempt
+		result.ResponseTime = milliseconds(time.Since(startTime))
+		result.Timing = types.Timing{
+			DNSLookup:    milliseconds(trace.DNSLookup),
+			Connect:      milliseconds(trace.Connect),
+			TLSHandshake: milliseconds(trace.TLSHandshake),
+			HTTP:         milliseconds(trace.HTTP),
+			Exchange:     milliseconds(trace.Exchange),
 		}
-		url += "dns-query"
-	}
+		result.HTTPVersion = trace.HTTPVersion
+		result.HTTPStatus = trace.HTTPStatus
+		result.ResponseSize = trace.ResponseSize
 
-	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
-
-	buf, err := msg.Pack()
-	if err != nil {
-		return fmt.Errorf("failed to pack DNS message: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewReader(buf))
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/dns-message")
-	req.Header.Set("Accept", "application/dns-message")
+		if err == nil {
+			return r, nil
+		}
+		result.AttemptErrors = append(result.AttemptErrors, err.Error())
+		if attempt > retries {
+			return nil, err
+		}
 
-	httpClient := &http.Client{
-		Timeout: 10 * time.Second,
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+		backoff *= 2
 	}
+}
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("HTTP request failed: %w", err)
-	}
-	defer resp.Body.Close()
+// milliseconds converts a duration to fractional milliseconds, truncated to whole microseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP request failed with status: %d", resp.StatusCode)
+// RcodeName returns the mnemonic for an rcode, e.g. NXDOMAIN, or its number if it has none.
+func RcodeName(rcode int) string {
+	if name, ok := dns.RcodeToString[rcode]; ok {
+		return name
 	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
 
-	respBuf := make([]byte, 4096)
-	n, err := resp.Body.Read(respBuf)
-	if err != nil && err.Error() != "EOF" {
-		return fmt.Errorf("failed to read response: %w", err)
+// serverTimeout returns the per-attempt timeout for a server.
+func serverTimeout(server types.Server) time.Duration {
+	if server.Timeout > 0 {
+		return time.Duration(server.Timeout)
 	}
+	return DefaultTimeout
+}
 
-	response := new(dns.Msg)
-	if err := response.Unpack(respBuf[:n]); err != nil {
-		return fmt.Errorf("failed to unpack DNS response: %w", err)
+// collectMetadata records the rcode, header flags, authority and additional sections, size and EDNS
+// options of a response, whatever its rcode.
+func collectMetadata(r *dns.Msg, result *types.QueryResult) {
+	result.Rcode = RcodeName(r.Rcode)
+	result.Flags = types.Flags{
+		AA: r.Authoritative,
+		TC: r.Truncated,
+		RD: r.RecursionDesired,
+		RA: r.RecursionAvailable,
+		AD: r.AuthenticatedData,
+		CD: r.CheckingDisabled,
+	}
+
+	// The DoH JSON API has no wire-format message; estimate its size as a server would send it,
+	// compressing names, which decoding does not remember
+	if result.ResponseSize == 0 {
+		compressed := *r
+		compressed.Compress = true
+		result.ResponseSize = compressed.Len()
+	}
+
+	for _, rr := range r.Ns {
+		result.Authority = append(result.Authority, newAnswer(rr))
+	}
+	for _, rr := range r.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			result.Additional = append(result.Additional, newAnswer(rr))
+		}
 	}
+	result.EDNS = collectEDNS(r)
+	result.ExtendedErrors = extendedErrors(r)
+}
 
-	if response.Rcode != dns.RcodeSuccess {
-		return fmt.Errorf("DNS query failed with RCODE: %d", response.Rcode)
-	}
+// collectAnswers records every answer-section RR as a typed Answer, and A/AAAA rdata as ResponseIPs.
+// RRSIGs returned because of the DO bit are skipped unless RRSIG was the query type.
+func collectAnswers(r *dns.Msg, result *types.QueryResult) {
+	skipSignatures := len(r.Question) == 0 || r.Question[0].Qtype != dns.TypeRRSIG
+	for _, answer := range r.Answer {
+		if answer.Header().Rrtype == dns.TypeRRSIG && skipSignatures {
+			continue
+		}
+		result.Answers = append(result.Answers, newAnswer(answer))
 
-	for _, answer := range response.Answer {
 		if a, ok := answer.(*dns.A); ok {
 			result.ResponseIPs = append(result.ResponseIPs, a.A.String())
 		}
@@ -241,7 +238,16 @@ func queryDoH(address string, domain string, result *types.QueryResult) error {
 			result.ResponseIPs = append(result.ResponseIPs, aaaa.AAAA.String())
 		}
 	}
+}
 
-	result.Success = true
-	return nil
+// newAnswer converts an RR to an Answer with its presentation-format rdata.
+func newAnswer(rr dns.RR) types.Answer {
+	header := rr.Header()
+	data := strings.TrimPrefix(rr.String(), header.String())
+	return types.Answer{
+		Name: header.Name,
+		Type: dns.TypeToString[header.Rrtype],
+		TTL:  header.Ttl,
+		Data: strings.ReplaceAll(data, "\t", " "),
+	}
 }
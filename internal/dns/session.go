@@ -0,0 +1,64 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+)
+
+// Session is a connection to a server that carries any number of exchanges, so that load generation
+// does not pay for a new connection per query. A Session is not safe for concurrent use; after an
+// exchange fails the connection may be unusable and the session should be closed.
+type Session interface {
+	Exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error)
+	Close() error
+}
+
+// SessionTransport is implemented by transports that can keep a connection open across exchanges.
+// Open records connection setup (lookup, connect, handshake) in the context Trace.
+type SessionTransport interface {
+	Transport
+	Open(ctx context.Context, server types.Server) (Session, error)
+}
+
+// OpenSession opens a session to server over protocol. Transports that do not implement
+// SessionTransport get a session that performs a full Transport.Exchange each time.
+func OpenSession(ctx context.Context, server types.Server, protocol string) (Session, error) {
+	transport, ok := LookupTransport(protocol)
+	if !ok {
+		return nil, fmt.Errorf("unsupported protocol: %s", protocol)
+	}
+	if sessions, ok := transport.(SessionTransport); ok {
+		return sessions.Open(ctx, server)
+	}
+	return exchangeSession{transport: transport, server: server}, nil
+}
+
+// exchangeSession adapts a Transport without connection reuse to the Session interface.
+type exchangeSession struct {
+	transport Transport
+	server    types.Server
+}
+
+func (s exchangeSession) Exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	return s.transport.Exchange(ctx, s.server, msg)
+}
+
+func (exchangeSession) Close() error {
+	return nil
+}
+
+// exchangeOnce opens a session, performs a single exchange and closes it. Transports implementing
+// SessionTransport use it for Exchange.
+func exchangeOnce(ctx context.Context, transport SessionTransport, server types.Server, msg *dns.Msg) (*dns.Msg, error) {
+	session, err := transport.Open(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	return session.Exchange(ctx, msg)
+}
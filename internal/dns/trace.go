@@ -0,0 +1,36 @@
+package dns
+
+import (
+	"context"
+	"time"
+)
+
+// Trace collects timing details that a transport observes during an exchange. Query attaches
+// a Trace to the context it passes to Transport.Exchange; transports fill in what they can measure.
+// Phases a transport does not go through, or skips by reusing a connection, stay zero.
+type Trace struct {
+	DNSLookup    time.Duration // resolving the server hostname
+	Connect      time.Duration // TCP connect (tcp, dot, doh); for udp, binding the socket
+	TLSHandshake time.Duration // TLS handshake (dot, doh) or QUIC handshake (doq)
+	HTTP         time.Duration // HTTP request and response on an established connection (doh)
+	Exchange     time.Duration // writing the query and reading the response on an established connection
+	HTTPVersion  string        // negotiated HTTP protocol (doh), e.g. "HTTP/2.0"
+	HTTPStatus   int           // HTTP response status code (doh)
+	ResponseSize int           // bytes of the DNS response message as received, without framing
+}
+
+type traceKey struct{}
+
+// WithTrace returns a context carrying trace.
+func WithTrace(ctx context.Context, trace *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// ContextTrace returns the Trace attached to ctx. When none is attached it returns a throwaway
+// Trace, so transports can record unconditionally.
+func ContextTrace(ctx context.Context) *Trace {
+	if trace, ok := ctx.Value(traceKey{}).(*Trace); ok {
+		return trace
+	}
+	return &Trace{}
+}
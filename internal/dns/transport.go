@@ -0,0 +1,180 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+)
+
+// Transport exchanges a DNS message with a server over one protocol. Implementations must honour
+// the context deadline and be safe for concurrent use. Response handling (rcode checks, answer
+// extraction) is shared by Query, so a transport only needs to deliver the reply message.
+type Transport interface {
+	Exchange(ctx context.Context, server types.Server, msg *dns.Msg) (*dns.Msg, error)
+}
+
+var (
+	transportsMu sync.RWMutex
+	transports   = make(map[string]Transport)
+)
+
+// Register makes a transport available under the given protocol name. Transports normally
+// register themselves from an init function. Register panics if the name is already taken.
+func Register(protocol string, transport Transport) {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	protocol = strings.ToLower(protocol)
+	if transport == nil {
+		panic("dns: Register transport is nil")
+	}
+	if _, dup := transports[protocol]; dup {
+		panic("dns: Register called twice for protocol " + protocol)
+	}
+	transports[protocol] = transport
+}
+
+// LookupTransport returns the transport registered for a protocol name (case-insensitive).
+func LookupTransport(protocol string) (Transport, bool) {
+	transportsMu.RLock()
+	defer transportsMu.RUnlock()
+
+	transport, ok := transports[strings.ToLower(protocol)]
+	return transport, ok
+}
+
+// Protocols returns the sorted names of all registered transports.
+func Protocols() []string {
+	transportsMu.RLock()
+	defer transportsMu.RUnlock()
+
+	protocols := make([]string, 0, len(transports))
+	for protocol := range transports {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+	return protocols
+}
+
+// withDefaultPort appends port to address unless it already carries one.
+func withDefaultPort(address string, port string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.Trim(address, "[]"), port)
+}
+
+// hostOf returns the host part of an address with or without a port.
+func hostOf(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return strings.Trim(address, "[]")
+}
+
+// resolveServer resolves the host of an address with a port to an IP address, recording the lookup
+// time in the context Trace. Addresses that already hold an IP address are returned unchanged.
+func resolveServer(ctx context.Context, address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return address, nil
+	}
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	ContextTrace(ctx).DNSLookup = time.Since(start)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve server address: %w", err)
+	}
+	return net.JoinHostPort(addrs[0].String(), port), nil
+}
+
+// dialServer resolves address and connects to it, recording the lookup and connect times in the
+// context Trace.
+func dialServer(ctx context.Context, network string, address string) (net.Conn, error) {
+	resolved, err := resolveServer(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, network, resolved)
+	ContextTrace(ctx).Connect = time.Since(start)
+	return conn, err
+}
+
+// exchangeTimeout bounds an exchange whose context has no deadline, as in the miekg/dns client.
+const exchangeTimeout = 2 * time.Second
+
+// exchangeOnConn writes msg to an established connection and reads the reply, recording the time and
+// the size of the reply as received in the context Trace. network selects the framing: "udp" or a
+// stream network. On UDP, replies with another message ID are skipped, as they may answer an earlier
+// query that timed out.
+func exchangeOnConn(ctx context.Context, network string, conn net.Conn, msg *dns.Msg) (*dns.Msg, error) {
+	trace := ContextTrace(ctx)
+	start := time.Now()
+	defer func() { trace.Exchange = time.Since(start) }()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = start.Add(exchangeTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	co := &dns.Conn{Conn: conn}
+	if opt := msg.IsEdns0(); opt != nil {
+		co.UDPSize = opt.UDPSize()
+	}
+	if err := co.WriteMsg(msg); err != nil {
+		return nil, err
+	}
+	for {
+		buf, err := co.ReadMsgHeader(nil)
+		if err != nil {
+			return nil, err
+		}
+		r := new(dns.Msg)
+		if err := r.Unpack(buf); err != nil {
+			return nil, err
+		}
+		if r.Id == msg.Id {
+			trace.ResponseSize = len(buf)
+			return r, nil
+		}
+		if network != "udp" {
+			return nil, dns.ErrId
+		}
+	}
+}
+
+// tlsConfig builds the client TLS configuration for a server. The ServerName defaults to the host
+// part of the address and can be overridden with tls_server_name.
+func tlsConfig(server types.Server, nextProtos ...string) *tls.Config {
+	serverName := server.TLSServerName
+	if serverName == "" {
+		serverName = hostOf(server.Address)
+	}
+	return &tls.Config{
+		ServerName:         serverName,
+		NextProtos:         nextProtos,
+		InsecureSkipVerify: server.TLSInsecureSkipVerify,
+	}
+}
+
+// errRcode formats a non-NOERROR response code by name.
+func errRcode(rcode int) error {
+	return fmt.Errorf("DNS query failed: %s", RcodeName(rcode))
+}
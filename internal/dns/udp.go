@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"context"
+	"net"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+)
+
+func init() {
+	Register("udp", plainTransport{network: "udp"})
+	Register("tcp", plainTransport{network: "tcp"})
+}
+
+// plainTransport performs unencrypted DNS over UDP or TCP (port 53). Uses github.com/miekg/dns.
+// Defaults to port 53 if no port is specified in the address. Sessions keep the UDP socket or the
+// TCP connection open and send queries on it one at a time.
+type plainTransport struct {
+	network string
+}
+
+func (t plainTransport) Exchange(ctx context.Context, server types.Server, msg *dns.Msg) (*dns.Msg, error) {
+	return exchangeOnce(ctx, t, server, msg)
+}
+
+func (t plainTransport) Open(ctx context.Context, server types.Server) (Session, error) {
+	conn, err := dialServer(ctx, t.network, withDefaultPort(server.Address, "53"))
+	if err != nil {
+		return nil, err
+	}
+	return &connSession{network: t.network, conn: conn}, nil
+}
+
+// connSession exchanges messages on a single UDP socket, TCP connection or TLS connection.
+type connSession struct {
+	network string // udp, tcp or tcp-tls
+	conn    net.Conn
+}
+
+func (s *connSession) Exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	return exchangeOnConn(ctx, s.network, s.conn, msg)
+}
+
+func (s *connSession) Close() error {
+	return s.conn.Close()
+}
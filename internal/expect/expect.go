@@ -0,0 +1,201 @@
+package expect
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"dnstester/pkg/types"
+
+	"github.com/miekg/dns"
+)
+
+// Validate checks that an expectation's addresses, CIDRs, rcode and regex parse.
+func Validate(e types.Expectation) error {
+	for _, ip := range e.IPs {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid expected IP '%s'", ip)
+		}
+	}
+	for _, cidr := range e.CIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid expected CIDR '%s'", cidr)
+		}
+	}
+	if _, ok := dns.StringToRcode[strings.ToUpper(e.Rcode)]; e.Rcode != "" && !ok {
+		return fmt.Errorf("unknown expected rcode '%s'", e.Rcode)
+	}
+	if e.MinTTL != nil && e.MaxTTL != nil && *e.MinTTL > *e.MaxTTL {
+		return fmt.Errorf("min_ttl %d is greater than max_ttl %d", *e.MinTTL, *e.MaxTTL)
+	}
+	if e.TXTRegex != "" {
+		if _, err := regexp.Compile(e.TXTRegex); err != nil {
+			return fmt.Errorf("invalid txt_regex: %w", err)
+		}
+	}
+	return nil
+}
+
+// Evaluate checks a result against an expectation. It is independent of result.Success: a query
+// expected to return NXDOMAIN passes its assertion even though the query itself is reported failed.
+func Evaluate(e types.Expectation, result types.QueryResult) *types.AssertionResult {
+	var failures []string
+	fail := func(format string, args ...interface{}) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	if result.Rcode == "" {
+		fail("no response: %s", result.Error)
+		return &types.AssertionResult{Passed: false, Failures: failures}
+	}
+
+	wantRcode := "NOERROR"
+	if e.Rcode != "" {
+		wantRcode = strings.ToUpper(e.Rcode)
+	}
+	if result.Rcode != wantRcode {
+		fail("rcode %s, expected %s", result.Rcode, wantRcode)
+	}
+
+	addresses := answersOfType(result.Answers, result.QueryType)
+	if isAddressType(result.QueryType) {
+		if expected := ipsOfFamily(e.IPs, result.QueryType); len(expected) > 0 {
+			if !sameSet(normalizeIPs(addresses), expected) {
+				fail("addresses [%s], expected [%s]", strings.Join(addresses, ", "), strings.Join(expected, ", "))
+			}
+		}
+		if len(e.CIDRs) > 0 {
+			for _, address := range addresses {
+				if !inAnyCIDR(address, e.CIDRs) {
+					fail("address %s is not within %s", address, strings.Join(e.CIDRs, ", "))
+				}
+			}
+		}
+	}
+
+	for _, answer := range result.Answers {
+		if e.MinTTL != nil && answer.TTL < *e.MinTTL {
+			fail("%s %s TTL %d is below min_ttl %d", answer.Type, answer.Data, answer.TTL, *e.MinTTL)
+		}
+		if e.MaxTTL != nil && answer.TTL > *e.MaxTTL {
+			fail("%s %s TTL %d is above max_ttl %d", answer.Type, answer.Data, answer.TTL, *e.MaxTTL)
+		}
+	}
+
+	if e.CNAME != "" && wantRcode == "NOERROR" {
+		targets := answersOfType(result.Answers, "CNAME")
+		if len(targets) == 0 {
+			fail("no CNAME, expected %s", e.CNAME)
+		} else if !strings.EqualFold(strings.TrimSuffix(targets[0], "."), strings.TrimSuffix(e.CNAME, ".")) {
+			fail("CNAME %s, expected %s", targets[0], e.CNAME)
+		}
+	}
+
+	if e.TXTRegex != "" && result.QueryType == "TXT" {
+		// Validate rejects invalid patterns, but expectations may not have been validated
+		if pattern, err := regexp.Compile(e.TXTRegex); err != nil {
+			fail("invalid txt_regex: %v", err)
+		} else if !anyMatch(pattern, answersOfType(result.Answers, "TXT")) {
+			fail("no TXT record matches /%s/", e.TXTRegex)
+		}
+	}
+
+	return &types.AssertionResult{Passed: len(failures) == 0, Failures: failures}
+}
+
+// anyMatch reports whether the text of any of the TXT rdata matches pattern.
+func anyMatch(pattern *regexp.Regexp, txts []string) bool {
+	for _, txt := range txts {
+		if pattern.MatchString(txtText(txt)) {
+			return true
+		}
+	}
+	return false
+}
+
+// txtText returns the text of TXT rdata, with the character-strings unquoted and concatenated.
+func txtText(data string) string {
+	rr, err := dns.NewRR(". 0 IN TXT " + data)
+	if err != nil {
+		return data
+	}
+	return strings.Join(rr.(*dns.TXT).Txt, "")
+}
+
+// isAddressType reports whether a query type returns addresses.
+func isAddressType(queryType string) bool {
+	return queryType == "A" || queryType == "AAAA"
+}
+
+// answersOfType returns the rdata of answers with the given type.
+func answersOfType(answers []types.Answer, rrType string) []string {
+	var data []string
+	for _, answer := range answers {
+		if answer.Type == rrType {
+			data = append(data, answer.Data)
+		}
+	}
+	return data
+}
+
+// ipsOfFamily returns the normalized expected addresses matching the query type's address family.
+func ipsOfFamily(ips []string, queryType string) []string {
+	var matching []string
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			continue
+		}
+		if (parsed.To4() != nil) == (queryType == "A") {
+			matching = append(matching, parsed.String())
+		}
+	}
+	return matching
+}
+
+// normalizeIPs canonicalises address strings so equal addresses compare equal.
+func normalizeIPs(ips []string) []string {
+	normalized := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			ip = parsed.String()
+		}
+		normalized = append(normalized, ip)
+	}
+	return normalized
+}
+
+// sameSet reports whether a and b contain the same strings, ignoring order and duplicates.
+func sameSet(a []string, b []string) bool {
+	return strings.Join(uniqueSorted(a), ",") == strings.Join(uniqueSorted(b), ",")
+}
+
+// uniqueSorted returns the distinct values of s in sorted order.
+func uniqueSorted(s []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// inAnyCIDR reports whether address lies within one of cidrs.
+func inAnyCIDR(address string, cidrs []string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
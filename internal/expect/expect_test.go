@@ -0,0 +1,169 @@
+package expect
+
+import (
+	"strings"
+	"testing"
+
+	"dnstester/pkg/types"
+)
+
+func ttl(v uint32) *uint32 {
+	return &v
+}
+
+// response returns a NOERROR result for queryType with the given answers.
+func response(queryType string, answers ...types.Answer) types.QueryResult {
+	return types.QueryResult{QueryType: queryType, Rcode: "NOERROR", Answers: answers}
+}
+
+func aRecord(data string, seconds uint32) types.Answer {
+	return types.Answer{Name: "example.com.", Type: "A", TTL: seconds, Data: data}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name        string
+		expectation types.Expectation
+		result      types.QueryResult
+		failures    []string // substrings of the expected failures, in order; none means passed
+	}{
+		{
+			name:        "address set matches in any order",
+			expectation: types.Expectation{IPs: []string{"192.0.2.2", "192.0.2.1"}},
+			result:      response("A", aRecord("192.0.2.1", 60), aRecord("192.0.2.2", 60)),
+		},
+		{
+			name:        "address set differs",
+			expectation: types.Expectation{IPs: []string{"192.0.2.1"}},
+			result:      response("A", aRecord("192.0.2.1", 60), aRecord("192.0.2.9", 60)),
+			failures:    []string{"addresses [192.0.2.1, 192.0.2.9], expected [192.0.2.1]"},
+		},
+		{
+			name:        "addresses of the other family are ignored",
+			expectation: types.Expectation{IPs: []string{"192.0.2.1", "2001:db8::1"}},
+			result:      response("AAAA", types.Answer{Type: "AAAA", Data: "2001:db8:0::1"}),
+		},
+		{
+			name:        "addresses within CIDRs",
+			expectation: types.Expectation{CIDRs: []string{"192.0.2.0/24", "198.51.100.0/24"}},
+			result:      response("A", aRecord("192.0.2.1", 60), aRecord("198.51.100.7", 60)),
+		},
+		{
+			name:        "address outside CIDRs",
+			expectation: types.Expectation{CIDRs: []string{"192.0.2.0/24"}},
+			result:      response("A", aRecord("192.0.2.1", 60), aRecord("203.0.113.1", 60)),
+			failures:    []string{"address 203.0.113.1 is not within 192.0.2.0/24"},
+		},
+		{
+			name:        "expected rcode",
+			expectation: types.Expectation{Rcode: "nxdomain"},
+			result:      types.QueryResult{QueryType: "A", Rcode: "NXDOMAIN", Error: "DNS query failed: NXDOMAIN"},
+		},
+		{
+			name:        "unexpected rcode",
+			expectation: types.Expectation{},
+			result:      types.QueryResult{QueryType: "A", Rcode: "SERVFAIL"},
+			failures:    []string{"rcode SERVFAIL, expected NOERROR"},
+		},
+		{
+			name:        "no response",
+			expectation: types.Expectation{Rcode: "NXDOMAIN"},
+			result:      types.QueryResult{QueryType: "A", Error: "i/o timeout"},
+			failures:    []string{"no response: i/o timeout"},
+		},
+		{
+			name:        "TTLs within bounds",
+			expectation: types.Expectation{MinTTL: ttl(60), MaxTTL: ttl(300)},
+			result:      response("A", aRecord("192.0.2.1", 60), aRecord("192.0.2.2", 300)),
+		},
+		{
+			name:        "TTLs outside bounds",
+			expectation: types.Expectation{MinTTL: ttl(60), MaxTTL: ttl(300)},
+			result:      response("A", aRecord("192.0.2.1", 30), aRecord("192.0.2.2", 600)),
+			failures:    []string{"A 192.0.2.1 TTL 30 is below min_ttl 60", "A 192.0.2.2 TTL 600 is above max_ttl 300"},
+		},
+		{
+			name:        "CNAME matches without trailing dot and case",
+			expectation: types.Expectation{CNAME: "Target.Example.NET"},
+			result:      response("A", types.Answer{Type: "CNAME", Data: "target.example.net."}, aRecord("192.0.2.1", 60)),
+		},
+		{
+			name:        "CNAME differs",
+			expectation: types.Expectation{CNAME: "target.example.net"},
+			result:      response("A", types.Answer{Type: "CNAME", Data: "other.example.net."}),
+			failures:    []string{"CNAME other.example.net., expected target.example.net"},
+		},
+		{
+			name:        "CNAME missing",
+			expectation: types.Expectation{CNAME: "target.example.net"},
+			result:      response("A", aRecord("192.0.2.1", 60)),
+			failures:    []string{"no CNAME, expected target.example.net"},
+		},
+		{
+			name:        "TXT regex matches unquoted text",
+			expectation: types.Expectation{TXTRegex: `^v=spf1 .*-all$`},
+			result:      response("TXT", types.Answer{Type: "TXT", Data: `"v=spf1 " "include:example.net -all"`}),
+		},
+		{
+			name:        "TXT regex does not match",
+			expectation: types.Expectation{TXTRegex: `^v=DMARC1`},
+			result:      response("TXT", types.Answer{Type: "TXT", Data: `"v=spf1 -all"`}),
+			failures:    []string{"no TXT record matches /^v=DMARC1/"},
+		},
+		{
+			name:        "invalid TXT regex fails instead of panicking",
+			expectation: types.Expectation{TXTRegex: `([`},
+			result:      response("TXT", types.Answer{Type: "TXT", Data: `"v=spf1 -all"`}),
+			failures:    []string{"invalid txt_regex"},
+		},
+		{
+			name:        "TXT regex only applies to TXT queries",
+			expectation: types.Expectation{TXTRegex: `^v=spf1`},
+			result:      response("A", aRecord("192.0.2.1", 60)),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertion := Evaluate(test.expectation, test.result)
+			if assertion.Passed != (len(test.failures) == 0) {
+				t.Errorf("passed %v with failures %q, want %d failures", assertion.Passed, assertion.Failures, len(test.failures))
+			}
+			if len(assertion.Failures) != len(test.failures) {
+				t.Fatalf("failures %q, want %q", assertion.Failures, test.failures)
+			}
+			for i, want := range test.failures {
+				if !strings.Contains(assertion.Failures[i], want) {
+					t.Errorf("failure %d %q, want it to contain %q", i, assertion.Failures[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		expectation types.Expectation
+		err         string // substring of the expected error, "" if valid
+	}{
+		{"valid", types.Expectation{IPs: []string{"192.0.2.1", "2001:db8::1"}, CIDRs: []string{"192.0.2.0/24"}, Rcode: "nxdomain", MinTTL: ttl(60), MaxTTL: ttl(60), TXTRegex: "^v="}, ""},
+		{"invalid IP", types.Expectation{IPs: []string{"192.0.2.256"}}, "invalid expected IP '192.0.2.256'"},
+		{"invalid CIDR", types.Expectation{CIDRs: []string{"192.0.2.0"}}, "invalid expected CIDR '192.0.2.0'"},
+		{"unknown rcode", types.Expectation{Rcode: "NOPE"}, "unknown expected rcode 'NOPE'"},
+		{"min TTL above max TTL", types.Expectation{MinTTL: ttl(300), MaxTTL: ttl(60)}, "min_ttl 300 is greater than max_ttl 60"},
+		{"invalid regex", types.Expectation{TXTRegex: "(["}, "invalid txt_regex"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.expectation)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && err == nil:
+				t.Errorf("no error, want %q", test.err)
+			case test.err != "" && !strings.Contains(err.Error(), test.err):
+				t.Errorf("error %q, want it to contain %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dnstester/pkg/types"
+)
+
+// ErrNotFound is returned by Get for an unknown run ID.
+var ErrNotFound = errors.New("run not found")
+
+// Run is a stored test run: the request that started it and its full report.
+type Run struct {
+	RunInfo
+	Request json.RawMessage `json:"request"` // the request as the server decoded it, re-encoded, so unknown fields are dropped
+	Report  types.Report    `json:"report"`
+}
+
+// RunInfo describes a stored run without its results, for listing.
+type RunInfo struct {
+	ID       string    `json:"id"`
+	State    string    `json:"state"` // e.g. completed or cancelled
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Servers  []string  `json:"servers"` // server names, in result order
+	Domains  []string  `json:"domains"` // domain names, in result order
+
+	TotalQueries int     `json:"total_queries"`
+	Successful   int     `json:"successful"`
+	Failed       int     `json:"failed"`
+	AverageTime  float64 `json:"average_time"`
+}
+
+// Filter selects runs to list. Zero fields match every run.
+type Filter struct {
+	Since  time.Time // runs started at or after Since
+	Until  time.Time // runs started before Until
+	Server string    // runs that queried a server with this name (case-insensitive)
+	Domain string    // runs that queried this domain (case-insensitive, trailing dot ignored)
+	Limit  int       // maximum number of runs, newest first
+}
+
+// Retention limits the runs a Store keeps. Zero fields are no limit.
+type Retention struct {
+	MaxRuns int           // keep at most this many runs, deleting the oldest first
+	MaxAge  time.Duration // delete runs started longer ago than this
+}
+
+// idPattern restricts run IDs to names that are safe as file names.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Store keeps runs as one JSON file each in a directory, with an in-memory index of their RunInfo.
+// It is safe for concurrent use.
+type Store struct {
+	dir       string
+	retention Retention
+
+	mu    sync.Mutex
+	index map[string]RunInfo
+}
+
+// Open opens the store in dir, creating the directory if needed, and indexes the runs already in it.
+// Files that cannot be read as runs are skipped. Runs beyond the retention limits are deleted now and
+// whenever a run is saved.
+func Open(dir string, retention Retention) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history directory: %w", err)
+	}
+
+	s := &Store{dir: dir, retention: retention, index: make(map[string]RunInfo)}
+	for _, path := range paths {
+		run, err := readRun(path)
+		if err != nil || !idPattern.MatchString(run.ID) {
+			continue
+		}
+		s.index[run.ID] = run.RunInfo
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save stores a run, filling its server and domain lists and summary counts from the report, then
+// deletes the runs beyond the retention limits. The file is written to a temporary name first so a
+// crash never leaves a partial run behind.
+func (s *Store) Save(run Run) error {
+	if !idPattern.MatchString(run.ID) {
+		return fmt.Errorf("invalid run ID '%s'", run.ID)
+	}
+	run.Servers, run.Domains = names(run.Report.Results)
+	run.TotalQueries = run.Report.Summary.TotalQueries
+	run.Successful = run.Report.Summary.Successful
+	run.Failed = run.Report.Summary.Failed
+	run.AverageTime = run.Report.Summary.AverageTime
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+	path := s.path(run.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index[run.ID] = run.RunInfo
+	return s.prune(time.Now())
+}
+
+// prune deletes the runs that started before the maximum age, then the oldest runs beyond the maximum
+// number. s.mu must be held.
+func (s *Store) prune(now time.Time) error {
+	runs := make([]RunInfo, 0, len(s.index))
+	for _, info := range s.index {
+		runs = append(runs, info)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Started.After(runs[j].Started) })
+
+	for i, info := range runs {
+		expired := s.retention.MaxAge > 0 && now.Sub(info.Started) > s.retention.MaxAge
+		excess := s.retention.MaxRuns > 0 && i >= s.retention.MaxRuns
+		if !expired && !excess {
+			continue
+		}
+		if err := os.Remove(s.path(info.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete run %s: %w", info.ID, err)
+		}
+		delete(s.index, info.ID)
+	}
+	return nil
+}
+
+// Get returns the stored run with the given ID, or ErrNotFound.
+func (s *Store) Get(id string) (*Run, error) {
+	s.mu.Lock()
+	_, ok := s.index[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	run, err := readRun(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return run, err
+}
+
+// List returns the runs that match filter, newest first.
+func (s *Store) List(filter Filter) []RunInfo {
+	s.mu.Lock()
+	runs := make([]RunInfo, 0, len(s.index))
+	for _, info := range s.index {
+		if filter.matches(info) {
+			runs = append(runs, info)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Started.After(runs[j].Started) })
+	if filter.Limit > 0 && len(runs) > filter.Limit {
+		runs = runs[:filter.Limit]
+	}
+	return runs
+}
+
+// matches reports whether a run passes the filter.
+func (f Filter) matches(info RunInfo) bool {
+	if !f.Since.IsZero() && info.Started.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !info.Started.Before(f.Until) {
+		return false
+	}
+	if f.Server != "" && !contains(info.Servers, f.Server) {
+		return false
+	}
+	if f.Domain != "" && !contains(info.Domains, strings.TrimSuffix(f.Domain, ".")) {
+		return false
+	}
+	return true
+}
+
+// path returns the file name of a run.
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// readRun reads a run file.
+func readRun(path string) (*Run, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to decode run %s: %w", filepath.Base(path), err)
+	}
+	return &run, nil
+}
+
+// names returns the distinct server and domain names of results, in result order.
+func names(results []types.QueryResult) (servers, domains []string) {
+	servers, domains = []string{}, []string{}
+	for _, result := range results {
+		if !contains(servers, result.ServerName) {
+			servers = append(servers, result.ServerName)
+		}
+		domain := strings.TrimSuffix(result.Domain, ".")
+		if !contains(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	return servers, domains
+}
+
+// contains reports whether values contains value, ignoring case.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
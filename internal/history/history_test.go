@@ -0,0 +1,121 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dnstester/pkg/types"
+)
+
+// testRun returns a run started age ago with one result.
+func testRun(id string, age time.Duration) Run {
+	return Run{
+		RunInfo: RunInfo{ID: id, State: "completed", Started: time.Now().Add(-age), Finished: time.Now()},
+		Report: types.Report{
+			Results: []types.QueryResult{{ServerName: "a", Domain: "example.com"}},
+			Summary: types.Summary{TotalQueries: 1, Successful: 1},
+		},
+	}
+}
+
+// ids returns the IDs of the runs in the store, newest first.
+func ids(s *Store) []string {
+	var list []string
+	for _, info := range s.List(Filter{}) {
+		list = append(list, info.ID)
+	}
+	return list
+}
+
+// files returns the names of the files in dir.
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestSavePrunesBeyondMaxRuns(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Retention{MaxRuns: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		// run0 is the oldest
+		if err := s.Save(testRun(fmt.Sprintf("run%d", i), time.Duration(5-i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := fmt.Sprint(ids(s)); got != "[run4 run3 run2]" {
+		t.Errorf("runs %s, want [run4 run3 run2]", got)
+	}
+	if got := fmt.Sprint(files(t, dir)); got != "[run2.json run3.json run4.json]" {
+		t.Errorf("files %s, want [run2.json run3.json run4.json]", got)
+	}
+	if _, err := s.Get("run0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("pruned run: error %v, want ErrNotFound", err)
+	}
+	if run, err := s.Get("run4"); err != nil || run.TotalQueries != 1 {
+		t.Errorf("kept run: %+v, %v", run, err)
+	}
+}
+
+func TestSavePrunesBeyondMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Retention{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range []Run{testRun("old", 2*time.Hour), testRun("recent", time.Minute), testRun("new", 0)} {
+		if err := s.Save(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := fmt.Sprint(ids(s)); got != "[new recent]" {
+		t.Errorf("runs %s, want [new recent]", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired run file still exists: %v", err)
+	}
+}
+
+func TestOpenPrunesExistingRuns(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := s.Save(testRun(fmt.Sprintf("run%d", i), time.Duration(4-i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(ids(s)); got != 4 {
+		t.Fatalf("%d runs kept without limits, want 4", got)
+	}
+
+	// run0 is too old, and only two of the others may be kept
+	s, err = Open(dir, Retention{MaxRuns: 2, MaxAge: 3*time.Hour + 30*time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(ids(s)); got != "[run3 run2]" {
+		t.Errorf("runs %s, want [run3 run2]", got)
+	}
+	if got := fmt.Sprint(files(t, dir)); got != "[run2.json run3.json]" {
+		t.Errorf("files %s, want [run2.json run3.json]", got)
+	}
+}
@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dnstester/pkg/types"
+)
+
+// DurationBuckets are the upper bounds, in seconds, of the query duration histogram buckets.
+var DurationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// noResponse is the rcode label of queries that received no response (timeouts, connection errors).
+const noResponse = "NONE"
+
+// Collector accumulates query results into Prometheus metrics and writes them in the text exposition
+// format. It is safe for concurrent use.
+type Collector struct {
+	mu      sync.Mutex
+	queries map[seriesKey]map[string]uint64 // target → rcode → count
+	targets map[seriesKey]*targetMetrics
+}
+
+// seriesKey holds the label values shared by all series of a target.
+type seriesKey struct {
+	server, protocol, domain, queryType string
+}
+
+// targetMetrics holds the gauges and duration histogram of one target.
+type targetMetrics struct {
+	success   bool
+	lastCheck float64 // Unix seconds
+	buckets   []uint64
+	sum       float64
+	count     uint64
+}
+
+// NewCollector creates an empty collector.
+func NewCollector() *Collector {
+	return &Collector{
+		queries: make(map[seriesKey]map[string]uint64),
+		targets: make(map[seriesKey]*targetMetrics),
+	}
+}
+
+// Observe records a query result. Durations are recorded only for queries that received a response.
+func (c *Collector) Observe(result types.QueryResult) {
+	key := seriesKey{result.ServerName, result.Protocol, result.Domain, result.QueryType}
+	now := float64(time.Now().UnixMilli()) / 1000
+	rcode := result.Rcode
+	if rcode == "" {
+		rcode = noResponse
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.queries[key] == nil {
+		c.queries[key] = make(map[string]uint64)
+	}
+	c.queries[key][rcode]++
+
+	t := c.targets[key]
+	if t == nil {
+		t = &targetMetrics{buckets: make([]uint64, len(DurationBuckets))}
+		c.targets[key] = t
+	}
+	t.success = result.Passed()
+	t.lastCheck = now
+	if result.Rcode != "" {
+		seconds := result.ResponseTime / 1000
+		for i, bound := range DurationBuckets {
+			if seconds <= bound {
+				t.buckets[i]++
+			}
+		}
+		t.sum += seconds
+		t.count++
+	}
+}
+
+// Write writes the collected metrics, plus the state of the given monitor targets, in the Prometheus
+// text exposition format.
+func (c *Collector) Write(w io.Writer, statuses []types.TargetStatus) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b strings.Builder
+
+	writeHeader(&b, "dnstester_queries_total", "counter", "DNS queries sent by scheduled checks, by response code (NONE when no response was received).")
+	for _, key := range sortedKeys(c.queries) {
+		rcodes := make([]string, 0, len(c.queries[key]))
+		for rcode := range c.queries[key] {
+			rcodes = append(rcodes, rcode)
+		}
+		sort.Strings(rcodes)
+		for _, rcode := range rcodes {
+			fmt.Fprintf(&b, "dnstester_queries_total{%s,rcode=\"%s\"} %d\n", key.labels(), escape(rcode), c.queries[key][rcode])
+		}
+	}
+
+	targets := sortedKeys(c.targets)
+
+	writeHeader(&b, "dnstester_query_success", "gauge", "Whether the last check passed (1) or failed (0).")
+	for _, key := range targets {
+		fmt.Fprintf(&b, "dnstester_query_success{%s} %d\n", key.labels(), boolValue(c.targets[key].success))
+	}
+
+	writeHeader(&b, "dnstester_last_check_timestamp_seconds", "gauge", "Unix time of the last check.")
+	for _, key := range targets {
+		fmt.Fprintf(&b, "dnstester_last_check_timestamp_seconds{%s} %s\n", key.labels(), formatFloat(c.targets[key].lastCheck))
+	}
+
+	writeHeader(&b, "dnstester_query_duration_seconds", "histogram", "Response time of queries that received a response.")
+	for _, key := range targets {
+		t := c.targets[key]
+		labels := key.labels()
+		for i, bound := range DurationBuckets {
+			fmt.Fprintf(&b, "dnstester_query_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(bound), t.buckets[i])
+		}
+		fmt.Fprintf(&b, "dnstester_query_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, t.count)
+		fmt.Fprintf(&b, "dnstester_query_duration_seconds_sum{%s} %s\n", labels, formatFloat(t.sum))
+		fmt.Fprintf(&b, "dnstester_query_duration_seconds_count{%s} %d\n", labels, t.count)
+	}
+
+	if len(statuses) > 0 {
+		writeHeader(&b, "dnstester_target_up", "gauge", "Monitor state of the target: 1 up, 0 down, -1 unknown.")
+		for _, status := range statuses {
+			state := -1
+			switch status.State {
+			case types.StateUp:
+				state = 1
+			case types.StateDown:
+				state = 0
+			}
+			fmt.Fprintf(&b, "dnstester_target_up{%s} %d\n", statusKey(status).labels(), state)
+		}
+
+		writeHeader(&b, "dnstester_target_availability_ratio", "gauge", "Fraction of passed checks in the monitor window.")
+		for _, status := range statuses {
+			fmt.Fprintf(&b, "dnstester_target_availability_ratio{%s} %s\n", statusKey(status).labels(), formatFloat(status.Availability))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labels formats the target labels, without braces.
+func (k seriesKey) labels() string {
+	return fmt.Sprintf("server=\"%s\",protocol=\"%s\",domain=\"%s\",query_type=\"%s\"",
+		escape(k.server), escape(k.protocol), escape(k.domain), escape(k.queryType))
+}
+
+// statusKey returns the series key of a monitor target.
+func statusKey(status types.TargetStatus) seriesKey {
+	return seriesKey{status.ServerName, status.Protocol, status.Domain, status.QueryType}
+}
+
+// sortedKeys returns the keys of m in label order, so scrapes list series consistently.
+func sortedKeys[V any](m map[seriesKey]V) []seriesKey {
+	keys := make([]seriesKey, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.server != b.server {
+			return a.server < b.server
+		}
+		if a.protocol != b.protocol {
+			return a.protocol < b.protocol
+		}
+		if a.domain != b.domain {
+			return a.domain < b.domain
+		}
+		return a.queryType < b.queryType
+	})
+	return keys
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric family.
+func writeHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
+
+// labelEscaper escapes label values as the text exposition format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape escapes a label value.
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// formatFloat formats a sample value.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// boolValue returns 1 for true and 0 for false.
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
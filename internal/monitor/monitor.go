@@ -0,0 +1,268 @@
+package monitor
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"dnstester/internal/report"
+	"dnstester/internal/runner"
+	"dnstester/pkg/types"
+)
+
+// Defaults used when the monitor configuration does not set its own values.
+const (
+	DefaultInterval          = time.Minute
+	DefaultWindow            = 20
+	DefaultFailureThreshold  = 3
+	DefaultRecoveryThreshold = 2
+)
+
+// Options configures a Monitor.
+type Options struct {
+	// Concurrency is the maximum number of queries in flight in each server's round. Values <= 0 use
+	// runner.DefaultConcurrency.
+	Concurrency int
+	// OnResult, if set, is called for every check as it completes.
+	OnResult func(result types.QueryResult)
+	// OnEvent, if set, is called when a target changes state.
+	OnEvent func(event types.MonitorEvent)
+	// OnRound, if set, is called when a server's scheduled run completes.
+	OnRound func(server types.Server, results []types.QueryResult)
+}
+
+// Monitor re-runs the test matrix of a configuration on a schedule and keeps the state and rolling
+// statistics of every target (server, protocol, domain and query type). Callbacks are serialized.
+type Monitor struct {
+	cfg  *types.Config
+	opts Options
+
+	mu      sync.Mutex
+	targets map[types.MonitorTarget]*target
+	order   []types.MonitorTarget
+
+	callbackMu sync.Mutex
+}
+
+// target holds the state of one monitor target and its recent checks.
+type target struct {
+	status types.TargetStatus
+	passes int     // consecutive passed checks
+	window []check // most recent checks, oldest first
+}
+
+// check is the outcome of one query in the rolling window.
+type check struct {
+	passed       bool
+	responseTime float64
+}
+
+// New creates a monitor for cfg. cfg must have defaults applied (see config.ApplyDefaults).
+func New(cfg *types.Config, opts Options) *Monitor {
+	m := &Monitor{
+		cfg:     cfg,
+		opts:    opts,
+		targets: make(map[types.MonitorTarget]*target),
+	}
+	for _, job := range runner.Plan(cfg) {
+		key := types.MonitorTarget{
+			ServerName:    job.Server.Name,
+			ServerAddress: job.Server.Address,
+			Protocol:      job.Protocol,
+			Domain:        job.Domain.Name,
+			QueryType:     job.QueryType,
+		}
+		if _, ok := m.targets[key]; ok {
+			continue
+		}
+		m.targets[key] = &target{status: types.TargetStatus{MonitorTarget: key, State: types.StateUnknown}}
+		m.order = append(m.order, key)
+	}
+	return m
+}
+
+// Run checks every server on its interval until ctx is cancelled. Each server runs on its own
+// schedule, starting immediately; a round that takes longer than the interval delays the next one.
+func (m *Monitor) Run(ctx context.Context) {
+	var servers []types.Server
+	jobs := make(map[string][]runner.Job)
+	for _, job := range runner.Plan(m.cfg) {
+		key := job.Server.Name + "|" + job.Server.Address
+		if _, ok := jobs[key]; !ok {
+			servers = append(servers, job.Server)
+		}
+		jobs[key] = append(jobs[key], job)
+	}
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server types.Server, jobs []runner.Job) {
+			defer wg.Done()
+			m.schedule(ctx, server, jobs)
+		}(server, jobs[server.Name+"|"+server.Address])
+	}
+	wg.Wait()
+}
+
+// schedule runs a server's jobs every interval.
+func (m *Monitor) schedule(ctx context.Context, server types.Server, jobs []runner.Job) {
+	interval := time.Duration(server.Interval)
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		results := runner.Run(ctx, jobs, runner.Options{
+			Concurrency: m.opts.Concurrency,
+			OnResult: func(job runner.Job, result types.QueryResult) {
+				// Queries cut short by shutdown say nothing about the server
+				if ctx.Err() == nil {
+					m.record(result)
+				}
+			},
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if m.opts.OnRound != nil {
+			m.callbackMu.Lock()
+			m.opts.OnRound(server, results)
+			m.callbackMu.Unlock()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// record updates a target with a check result and reports a state change.
+func (m *Monitor) record(result types.QueryResult) {
+	key := types.MonitorTarget{
+		ServerName:    result.ServerName,
+		ServerAddress: result.ServerAddress,
+		Protocol:      result.Protocol,
+		Domain:        result.Domain,
+		QueryType:     result.QueryType,
+	}
+	passed := result.Passed()
+	now := time.Now()
+
+	m.mu.Lock()
+	t, ok := m.targets[key]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	t.window = append(t.window, check{passed: passed, responseTime: result.ResponseTime})
+	if window := m.window(); len(t.window) > window {
+		t.window = t.window[len(t.window)-window:]
+	}
+
+	status := &t.status
+	status.Checks++
+	status.LastCheck = now
+	if passed {
+		t.passes++
+		status.ConsecutiveFailures = 0
+		status.LastError = ""
+	} else {
+		t.passes = 0
+		status.Failures++
+		status.ConsecutiveFailures++
+		status.LastError = failureReason(result)
+	}
+
+	from := status.State
+	to := from
+	switch {
+	case from != types.StateUp && t.passes >= m.recoveryThreshold():
+		to = types.StateUp
+	case from != types.StateDown && status.ConsecutiveFailures >= m.failureThreshold():
+		to = types.StateDown
+	}
+	var event *types.MonitorEvent
+	if to != from {
+		status.State = to
+		status.Since = now
+		event = &types.MonitorEvent{MonitorTarget: key, Time: now, From: from, To: to, Error: status.LastError}
+	}
+	m.mu.Unlock()
+
+	m.callbackMu.Lock()
+	defer m.callbackMu.Unlock()
+	if m.opts.OnResult != nil {
+		m.opts.OnResult(result)
+	}
+	if event != nil && m.opts.OnEvent != nil {
+		m.opts.OnEvent(*event)
+	}
+}
+
+// Snapshot returns the current status of every target, in the order of the test matrix.
+func (m *Monitor) Snapshot() []types.TargetStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]types.TargetStatus, 0, len(m.order))
+	for _, key := range m.order {
+		t := m.targets[key]
+		status := t.status
+
+		var passed []float64
+		for _, c := range t.window {
+			if c.passed {
+				passed = append(passed, c.responseTime)
+			}
+		}
+		if len(t.window) > 0 {
+			status.Availability = float64(len(passed)) / float64(len(t.window))
+		}
+		status.Latency = report.Latency(passed)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// window returns the configured rolling window size.
+func (m *Monitor) window() int {
+	if m.cfg.Monitor.Window > 0 {
+		return m.cfg.Monitor.Window
+	}
+	return DefaultWindow
+}
+
+// failureThreshold returns the number of consecutive failures that mark a target down.
+func (m *Monitor) failureThreshold() int {
+	if m.cfg.Monitor.FailureThreshold > 0 {
+		return m.cfg.Monitor.FailureThreshold
+	}
+	return DefaultFailureThreshold
+}
+
+// recoveryThreshold returns the number of consecutive passes that mark a target up.
+func (m *Monitor) recoveryThreshold() int {
+	if m.cfg.Monitor.RecoveryThreshold > 0 {
+		return m.cfg.Monitor.RecoveryThreshold
+	}
+	return DefaultRecoveryThreshold
+}
+
+// failureReason describes why a check failed: the unmet expectations, or the query error with any
+// Extended DNS Errors.
+func failureReason(result types.QueryResult) string {
+	if result.Assertion != nil && !result.Assertion.Passed {
+		return "assertion failed: " + strings.Join(result.Assertion.Failures, "; ")
+	}
+	reason := result.Error
+	for _, ede := range result.ExtendedErrors {
+		reason += "; " + ede.String()
+	}
+	return reason
+}
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dnstester/pkg/types"
+)
+
+// Failure policy kinds
+const (
+	Any            = "any"              // any failed query fails the run
+	AllServersDown = "all-servers-down" // the run fails only when no server answered any query correctly
+	Threshold      = "threshold"        // the run fails when more than a percentage of queries failed
+)
+
+// Policy decides whether the failed queries of a run fail the run. Failures of critical servers
+// (Server.Critical) always do.
+type Policy struct {
+	Kind      string
+	Threshold float64 // percentage of failed queries tolerated, for the threshold kind
+}
+
+// Parse parses a policy: "any", "all-servers-down" or "threshold=N%" (the % sign is optional).
+func Parse(s string) (Policy, error) {
+	switch s {
+	case Any, AllServersDown:
+		return Policy{Kind: s}, nil
+	}
+	if value, ok := strings.CutPrefix(s, Threshold+"="); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return Policy{}, fmt.Errorf("invalid threshold '%s': must be a percentage between 0 and 100", value)
+		}
+		return Policy{Kind: Threshold, Threshold: percent}, nil
+	}
+	return Policy{}, fmt.Errorf("invalid failure policy '%s'. Must be one of: %s, %s, %s=N%%", s, Any, AllServersDown, Threshold)
+}
+
+// Outcome is the verdict of a policy on a run.
+type Outcome struct {
+	Failed bool
+	// QueryFailures and AssertionFailures count the failures that failed the run: queries that got no
+	// usable response (or an error rcode without expectations), and responses that did not meet their
+	// domain's expectations.
+	QueryFailures     int
+	AssertionFailures int
+	Reason            string // why the run failed
+}
+
+// Evaluate applies the policy to the results of a run against servers.
+func (p Policy) Evaluate(servers []types.Server, results []types.QueryResult) Outcome {
+	critical := make(map[string]bool)
+	for _, server := range servers {
+		if server.Critical {
+			critical[server.Name] = true
+		}
+	}
+
+	var failed, criticalFailed []types.QueryResult
+	passedServers := make(map[string]bool)
+	for _, result := range results {
+		if result.Passed() {
+			passedServers[result.ServerName] = true
+			continue
+		}
+		failed = append(failed, result)
+		if critical[result.ServerName] {
+			criticalFailed = append(criticalFailed, result)
+		}
+	}
+	if len(failed) == 0 {
+		return Outcome{}
+	}
+
+	switch p.Kind {
+	case AllServersDown:
+		if len(passedServers) == 0 {
+			return outcome(failed, "all servers are down")
+		}
+	case Threshold:
+		rate := float64(len(failed)) / float64(len(results)) * 100
+		if rate > p.Threshold {
+			return outcome(failed, fmt.Sprintf("%d of %d queries failed (%.1f%%, threshold %g%%)", len(failed), len(results), rate, p.Threshold))
+		}
+	default:
+		return outcome(failed, fmt.Sprintf("%d of %d queries failed", len(failed), len(results)))
+	}
+
+	if len(criticalFailed) > 0 {
+		return outcome(criticalFailed, fmt.Sprintf("%d queries to critical servers failed", len(criticalFailed)))
+	}
+	return Outcome{}
+}
+
+// outcome builds a failed outcome from the failures that caused it.
+func outcome(failures []types.QueryResult, reason string) Outcome {
+	o := Outcome{Failed: true, Reason: reason}
+	for _, result := range failures {
+		if result.Rcode != "" && result.Assertion != nil {
+			o.AssertionFailures++
+		} else {
+			o.QueryFailures++
+		}
+	}
+	return o
+}
@@ -0,0 +1,93 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"dnstester/pkg/types"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Policy
+		err  string
+	}{
+		{"any", Policy{Kind: Any}, ""},
+		{"all-servers-down", Policy{Kind: AllServersDown}, ""},
+		{"threshold=10%", Policy{Kind: Threshold, Threshold: 10}, ""},
+		{"threshold=2.5", Policy{Kind: Threshold, Threshold: 2.5}, ""},
+		{"threshold=101%", Policy{}, "between 0 and 100"},
+		{"threshold=-1", Policy{}, "between 0 and 100"},
+		{"threshold=many", Policy{}, "invalid threshold 'many'"},
+		{"some", Policy{}, "invalid failure policy 'some'"},
+		{"", Policy{}, "invalid failure policy"},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			got, err := Parse(test.in)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, want it to contain %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("policy %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// passed, failed and unmet build results of server: a successful query, a query without a usable
+// response, and a response that did not meet its expectations.
+func passed(server string) types.QueryResult {
+	return types.QueryResult{ServerName: server, Rcode: "NOERROR", Success: true}
+}
+
+func failed(server string) types.QueryResult {
+	return types.QueryResult{ServerName: server, Error: "i/o timeout"}
+}
+
+func unmet(server string) types.QueryResult {
+	return types.QueryResult{ServerName: server, Rcode: "NOERROR", Success: true, Assertion: &types.AssertionResult{Failures: []string{"rcode NOERROR, expected NXDOMAIN"}}}
+}
+
+func TestEvaluate(t *testing.T) {
+	servers := []types.Server{{Name: "a"}, {Name: "b"}, {Name: "critical", Critical: true}}
+	tests := []struct {
+		name    string
+		policy  string
+		results []types.QueryResult
+		want    Outcome
+	}{
+		{"any without failures", "any", []types.QueryResult{passed("a"), passed("b")}, Outcome{}},
+		{"any with a failure", "any", []types.QueryResult{passed("a"), failed("b")}, Outcome{Failed: true, QueryFailures: 1}},
+		{"any counts both kinds", "any", []types.QueryResult{unmet("a"), failed("b"), unmet("b")}, Outcome{Failed: true, QueryFailures: 1, AssertionFailures: 2}},
+		{"expected error rcode passes", "any", []types.QueryResult{{ServerName: "a", Rcode: "NXDOMAIN", Assertion: &types.AssertionResult{Passed: true}}}, Outcome{}},
+		{"all servers down with one server up", "all-servers-down", []types.QueryResult{failed("a"), passed("b")}, Outcome{}},
+		{"all servers down", "all-servers-down", []types.QueryResult{failed("a"), unmet("b")}, Outcome{Failed: true, QueryFailures: 1, AssertionFailures: 1}},
+		{"below threshold", "threshold=25%", []types.QueryResult{failed("a"), passed("a"), passed("b"), passed("b")}, Outcome{}},
+		{"above threshold", "threshold=20%", []types.QueryResult{failed("a"), passed("a"), passed("b"), passed("b")}, Outcome{Failed: true, QueryFailures: 1}},
+		{"critical server fails under all-servers-down", "all-servers-down", []types.QueryResult{passed("a"), failed("b"), unmet("critical")}, Outcome{Failed: true, AssertionFailures: 1}},
+		{"critical server fails under threshold", "threshold=50%", []types.QueryResult{passed("a"), passed("b"), failed("critical")}, Outcome{Failed: true, QueryFailures: 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := Parse(test.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := p.Evaluate(servers, test.results)
+			if got.Failed != test.want.Failed || got.QueryFailures != test.want.QueryFailures || got.AssertionFailures != test.want.AssertionFailures {
+				t.Errorf("outcome %+v, want %+v", got, test.want)
+			}
+			if got.Failed && got.Reason == "" {
+				t.Errorf("failed outcome without a reason")
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"dnstester/pkg/types"
+)
+
+// histogramWidth is the length of the bar drawn for the fullest histogram bucket.
+const histogramWidth = 40
+
+// GenerateBenchReport writes a benchmark report as text or JSON. If outputFile is empty, writes to stdout.
+func GenerateBenchReport(bench types.BenchReport, outputFile string, format string) error {
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("invalid benchmark report format '%s' (valid formats: %s, %s)", format, FormatText, FormatJSON)
+	}
+
+	writer, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	if writer != os.Stdout {
+		defer writer.Close()
+	}
+
+	if format == FormatJSON {
+		return generateJSONReport(writer, bench)
+	}
+
+	fmt.Fprintf(writer, "DNS Benchmark Report\n")
+	fmt.Fprintf(writer, "====================\n\n")
+
+	target := "unlimited"
+	if bench.TargetQPS > 0 {
+		target = fmt.Sprintf("%.0f", bench.TargetQPS)
+	}
+	fmt.Fprintf(writer, "Server:           %s (%s)\n", bench.ServerName, bench.ServerAddress)
+	fmt.Fprintf(writer, "Protocol:         %s\n", bench.Protocol)
+	fmt.Fprintf(writer, "Clients:          %d\n", bench.Clients)
+	fmt.Fprintf(writer, "Target QPS:       %s\n", target)
+	fmt.Fprintf(writer, "Duration:         %.2f s\n\n", bench.Duration)
+
+	fmt.Fprintf(writer, "Sent:             %d\n", bench.Sent)
+	fmt.Fprintf(writer, "Responses:        %d\n", bench.Responses)
+	fmt.Fprintf(writer, "Timeouts:         %d (%.2f%%)\n", bench.Timeouts, bench.TimeoutRate*100)
+	fmt.Fprintf(writer, "Errors:           %d\n", bench.Errors)
+	if bench.FirstError != "" {
+		fmt.Fprintf(writer, "First Error:      %s\n", bench.FirstError)
+	}
+	fmt.Fprintf(writer, "Achieved QPS:     %.1f\n", bench.AchievedQPS)
+	fmt.Fprintf(writer, "Connections:      %d", bench.Connections)
+	if bench.Connections > 0 {
+		fmt.Fprintf(writer, " (%.1f queries per connection)", float64(bench.Sent)/float64(bench.Connections))
+	}
+	fmt.Fprintf(writer, "\n")
+
+	if bench.Responses > 0 {
+		latency := bench.Latency
+		fmt.Fprintf(writer, "\nLatency\n")
+		fmt.Fprintf(writer, "-------\n")
+		fmt.Fprintf(writer, "Average:          %.3f ms\n", latency.Average)
+		fmt.Fprintf(writer, "Min / Max:        %.3f ms / %.3f ms\n", latency.Min, latency.Max)
+		fmt.Fprintf(writer, "Percentiles:      p50 %.3f ms, p90 %.3f ms, p95 %.3f ms, p99 %.3f ms\n",
+			latency.P50, latency.P90, latency.P95, latency.P99)
+		fmt.Fprintf(writer, "Std Deviation:    %.3f ms\n", latency.StdDev)
+
+		writeHistogram(writer, bench.Histogram)
+	}
+
+	if len(bench.Rcodes) > 0 {
+		fmt.Fprintf(writer, "\nResponse Codes\n")
+		fmt.Fprintf(writer, "--------------\n")
+		rcodes := make([]string, 0, len(bench.Rcodes))
+		for rcode := range bench.Rcodes {
+			rcodes = append(rcodes, rcode)
+		}
+		sort.Slice(rcodes, func(i, j int) bool { return bench.Rcodes[rcodes[i]] > bench.Rcodes[rcodes[j]] })
+		tw := tabwriter.NewWriter(writer, 0, 0, 3, ' ', 0)
+		for _, rcode := range rcodes {
+			count := bench.Rcodes[rcode]
+			fmt.Fprintf(tw, "%s\t%d\t%.2f%%\n", rcode, count, float64(count)/float64(bench.Responses)*100)
+		}
+		tw.Flush()
+	}
+
+	return nil
+}
+
+// writeHistogram draws the non-empty range of latency buckets as horizontal bars.
+func writeHistogram(writer *os.File, buckets []types.HistogramBucket) {
+	first, last, most := -1, -1, 0
+	for i, bucket := range buckets {
+		if bucket.Count == 0 {
+			continue
+		}
+		if first == -1 {
+			first = i
+		}
+		last = i
+		most = max(most, bucket.Count)
+	}
+	if first == -1 {
+		return
+	}
+
+	fmt.Fprintf(writer, "\nLatency Histogram (ms)\n")
+	tw := tabwriter.NewWriter(writer, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, bucket := range buckets[first : last+1] {
+		bound := fmt.Sprintf("%g - %g", bucket.LowerBound, bucket.UpperBound)
+		if bucket.UpperBound == 0 {
+			bound = fmt.Sprintf("%g+", bucket.LowerBound)
+		}
+		bar := strings.Repeat("█", (bucket.Count*histogramWidth+most-1)/most)
+		fmt.Fprintf(tw, "%s\t%d\t %s\n", bound, bucket.Count, bar)
+	}
+	tw.Flush()
+}
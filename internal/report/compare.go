@@ -0,0 +1,264 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"dnstester/pkg/types"
+)
+
+// Default latency regression thresholds: a query regresses when its response time grows by more than
+// DefaultLatencyThreshold (relative) and by at least DefaultLatencyMinDelta milliseconds.
+const (
+	DefaultLatencyThreshold = 0.5
+	DefaultLatencyMinDelta  = 10.0
+)
+
+// CompareOptions configures what Compare counts as a regression.
+type CompareOptions struct {
+	LatencyThreshold float64 // relative response time increase, e.g. 0.5 for +50%
+	LatencyMinDelta  float64 // minimum response time increase in ms, so fast queries do not flap
+	AnswersRegress   bool    // count changed answer sets as regressions
+}
+
+// LoadReport reads a JSON report written by -format json. A stored run from the server history
+// (GET /api/report/{id}) is also accepted, using its report.
+func LoadReport(path string) (*types.Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var document struct {
+		types.Report
+		Stored *types.Report `json:"report"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	if document.Stored != nil {
+		return document.Stored, nil
+	}
+	if document.Results == nil {
+		return nil, fmt.Errorf("%s is not a JSON report: no results", path)
+	}
+	return &document.Report, nil
+}
+
+// Compare matches the results of two reports by server, protocol, domain and query type and lists
+// what changed from baseline to current: queries that started failing or recovered (by their
+// expectations when they have any, see QueryResult.Passed), changed answer sets (ignoring TTLs and
+// record order), latency regressions among queries that passed in both, and added or removed queries.
+// New failures and latency regressions count as regressions.
+func Compare(baseline, current *types.Report, opts CompareOptions) types.Comparison {
+	comparison := types.Comparison{
+		LatencyThreshold: opts.LatencyThreshold,
+		LatencyMinDelta:  opts.LatencyMinDelta,
+		Changes:          []types.Change{},
+	}
+
+	// A query that appears more than once in a report is compared by its first result in both
+	before := make(map[string]types.QueryResult)
+	for _, result := range baseline.Results {
+		key := compareKey(result)
+		if _, ok := before[key]; !ok {
+			before[key] = result
+		}
+	}
+	seen := make(map[string]bool)
+
+	for _, after := range current.Results {
+		key := compareKey(after)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		old, ok := before[key]
+		if !ok {
+			addChange(&comparison, types.ChangeAdded, false, nil, &after, "", describe(after))
+			continue
+		}
+		comparison.Compared++
+
+		switch {
+		case old.Passed() && !after.Passed():
+			addChange(&comparison, types.ChangeNewFailure, true, &old, &after, describe(old), describe(after))
+		case !old.Passed() && after.Passed():
+			addChange(&comparison, types.ChangeRecovered, false, &old, &after, describe(old), describe(after))
+		}
+
+		// A query that started failing or recovered is reported once, not again as an answer change
+		if old.Passed() == after.Passed() && old.Rcode != "" && after.Rcode != "" && answerSet(old) != answerSet(after) {
+			addChange(&comparison, types.ChangeAnswers, opts.AnswersRegress, &old, &after, answerSet(old), answerSet(after))
+		}
+
+		if old.Passed() && after.Passed() {
+			increase := after.ResponseTime - old.ResponseTime
+			if increase >= opts.LatencyMinDelta && increase > old.ResponseTime*opts.LatencyThreshold {
+				addChange(&comparison, types.ChangeLatency, true, &old, &after, "", "")
+			}
+		}
+	}
+
+	for _, old := range baseline.Results {
+		key := compareKey(old)
+		if !seen[key] {
+			seen[key] = true
+			addChange(&comparison, types.ChangeRemoved, false, &old, nil, describe(old), "")
+		}
+	}
+	return comparison
+}
+
+// addChange records a change between the baseline and current result of a query, either of which may
+// be nil, and counts it.
+func addChange(comparison *types.Comparison, kind string, regression bool, old, current *types.QueryResult, before, after string) {
+	result := current
+	if result == nil {
+		result = old
+	}
+	change := types.Change{
+		Kind:       kind,
+		ServerName: result.ServerName,
+		Protocol:   result.Protocol,
+		Domain:     result.Domain,
+		QueryType:  result.QueryType,
+		Regression: regression,
+		Before:     before,
+		After:      after,
+	}
+	if old != nil {
+		change.BeforeTime = old.ResponseTime
+	}
+	if current != nil {
+		change.AfterTime = current.ResponseTime
+	}
+	comparison.Changes = append(comparison.Changes, change)
+
+	switch kind {
+	case types.ChangeNewFailure:
+		comparison.NewFailures++
+	case types.ChangeRecovered:
+		comparison.Recovered++
+	case types.ChangeAnswers:
+		comparison.AnswerChanges++
+	case types.ChangeLatency:
+		comparison.LatencyRegressions++
+	case types.ChangeAdded:
+		comparison.Added++
+	case types.ChangeRemoved:
+		comparison.Removed++
+	}
+	if regression {
+		comparison.Regressions++
+	}
+}
+
+// compareKey identifies the same query across reports.
+func compareKey(result types.QueryResult) string {
+	return strings.Join([]string{result.ServerName, result.Protocol, strings.ToLower(result.Domain), result.QueryType}, "|")
+}
+
+// describe summarises a result's outcome: its answer set when it passed, or why it failed.
+func describe(result types.QueryResult) string {
+	if result.Passed() {
+		return answerSet(result)
+	}
+	if result.Assertion != nil && !result.Assertion.Passed {
+		return formatAssertion(result.Assertion, "", "assertion failed: ")
+	}
+	if result.Error != "" {
+		return result.Error
+	}
+	return answerSet(result)
+}
+
+// GenerateComparisonReport writes a comparison as text or JSON. If outputFile is empty, writes to stdout.
+func GenerateComparisonReport(comparison types.Comparison, outputFile string, format string) error {
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("invalid comparison report format '%s' (valid formats: %s, %s)", format, FormatText, FormatJSON)
+	}
+
+	writer, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	if writer != os.Stdout {
+		defer writer.Close()
+	}
+
+	if format == FormatJSON {
+		return generateJSONReport(writer, comparison)
+	}
+
+	fmt.Fprintf(writer, "DNS Report Comparison\n")
+	fmt.Fprintf(writer, "=====================\n\n")
+
+	fmt.Fprintf(writer, "Baseline:            %s\n", comparison.Baseline)
+	fmt.Fprintf(writer, "Current:             %s\n", comparison.Current)
+	fmt.Fprintf(writer, "Latency Threshold:   +%.0f%% and +%.3f ms\n\n", comparison.LatencyThreshold*100, comparison.LatencyMinDelta)
+
+	fmt.Fprintf(writer, "Compared Queries:    %d\n", comparison.Compared)
+	fmt.Fprintf(writer, "New Failures:        %d\n", comparison.NewFailures)
+	fmt.Fprintf(writer, "Recovered:           %d\n", comparison.Recovered)
+	fmt.Fprintf(writer, "Changed Answers:     %d\n", comparison.AnswerChanges)
+	fmt.Fprintf(writer, "Latency Regressions: %d\n", comparison.LatencyRegressions)
+	fmt.Fprintf(writer, "Added / Removed:     %d / %d\n", comparison.Added, comparison.Removed)
+	fmt.Fprintf(writer, "Regressions:         %d\n", comparison.Regressions)
+
+	if len(comparison.Changes) == 0 {
+		fmt.Fprintf(writer, "\nNo changes.\n")
+		return nil
+	}
+
+	fmt.Fprintf(writer, "\nChanges\n")
+	fmt.Fprintf(writer, "=======\n\n")
+
+	tw := tabwriter.NewWriter(writer, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "\tChange\tServer\tDomain\tType\tProtocol\tBefore\tAfter")
+	fmt.Fprintln(tw, "\t------\t------\t------\t----\t--------\t------\t-----")
+	for _, change := range comparison.Changes {
+		marker := ""
+		if change.Regression {
+			marker = "✗"
+		}
+		before, after := change.Before, change.After
+		if change.Kind == types.ChangeLatency {
+			before = fmt.Sprintf("%.3f ms", change.BeforeTime)
+			after = fmt.Sprintf("%.3f ms (+%.0f%%)", change.AfterTime, (change.AfterTime/change.BeforeTime-1)*100)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", marker, changeLabel(change.Kind),
+			change.ServerName, change.Domain, change.QueryType, change.Protocol, orDash(before), orDash(after))
+	}
+	return tw.Flush()
+}
+
+// changeLabel names a change kind in text reports.
+func changeLabel(kind string) string {
+	switch kind {
+	case types.ChangeNewFailure:
+		return "new failure"
+	case types.ChangeRecovered:
+		return "recovered"
+	case types.ChangeAnswers:
+		return "answers changed"
+	case types.ChangeLatency:
+		return "slower"
+	case types.ChangeAdded:
+		return "added"
+	case types.ChangeRemoved:
+		return "removed"
+	}
+	return kind
+}
+
+// orDash returns s, or "-" when it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
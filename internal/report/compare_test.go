@@ -0,0 +1,166 @@
+package report
+
+import (
+	"testing"
+
+	"dnstester/pkg/types"
+)
+
+// result builds a result of server "a" over udp for an A query of domain. An empty ip makes it a
+// timeout, and an rcode name such as "NXDOMAIN" a response with that rcode.
+func result(domain, ip string, ms float64) types.QueryResult {
+	r := types.QueryResult{ServerName: "a", Protocol: "udp", Domain: domain, QueryType: "A", ResponseTime: ms}
+	switch ip {
+	case "":
+		r.Error = "i/o timeout"
+	case "NXDOMAIN", "SERVFAIL":
+		r.Rcode = ip
+		r.Error = "DNS query failed: " + ip
+	default:
+		r.Rcode = "NOERROR"
+		r.Success = true
+		r.Answers = []types.Answer{{Name: domain + ".", Type: "A", TTL: 60, Data: ip}}
+	}
+	return r
+}
+
+func TestCompare(t *testing.T) {
+	defaults := CompareOptions{LatencyThreshold: DefaultLatencyThreshold, LatencyMinDelta: DefaultLatencyMinDelta}
+	tests := []struct {
+		name     string
+		opts     CompareOptions
+		baseline []types.QueryResult
+		current  []types.QueryResult
+		kinds    []string // kinds of the expected changes, in order
+		regress  int
+	}{
+		{
+			name:     "unchanged",
+			baseline: []types.QueryResult{result("a.test", "192.0.2.1", 10)},
+			current:  []types.QueryResult{result("A.TEST", "192.0.2.1", 12)},
+		},
+		{
+			name:     "new failure",
+			baseline: []types.QueryResult{result("a.test", "192.0.2.1", 10)},
+			current:  []types.QueryResult{result("a.test", "", 0)},
+			kinds:    []string{types.ChangeNewFailure},
+			regress:  1,
+		},
+		{
+			name:     "recovered",
+			baseline: []types.QueryResult{result("a.test", "", 0)},
+			current:  []types.QueryResult{result("a.test", "192.0.2.1", 10)},
+			kinds:    []string{types.ChangeRecovered},
+		},
+		{
+			name:     "answers changed",
+			baseline: []types.QueryResult{result("a.test", "192.0.2.1", 10)},
+			current:  []types.QueryResult{result("a.test", "192.0.2.2", 10)},
+			kinds:    []string{types.ChangeAnswers},
+		},
+		{
+			name:     "answers changed as a regression",
+			opts:     CompareOptions{LatencyThreshold: DefaultLatencyThreshold, LatencyMinDelta: DefaultLatencyMinDelta, AnswersRegress: true},
+			baseline: []types.QueryResult{result("a.test", "192.0.2.1", 10)},
+			current:  []types.QueryResult{result("a.test", "192.0.2.2", 10)},
+			kinds:    []string{types.ChangeAnswers},
+			regress:  1,
+		},
+		{
+			name:     "error rcode changed among failures",
+			baseline: []types.QueryResult{result("a.test", "NXDOMAIN", 10)},
+			current:  []types.QueryResult{result("a.test", "SERVFAIL", 10)},
+			kinds:    []string{types.ChangeAnswers},
+		},
+		{
+			name:     "latency above both thresholds",
+			baseline: []types.QueryResult{result("a.test", "192.0.2.1", 20)},
+			current:  []types.QueryResult{result("a.test", "192.0.2.1", 40)},
+			kinds:    []string{types.ChangeLatency},
+			regress:  1,
+		},
+		{
+			name:     "latency above the threshold but below the minimum delta",
+			baseline: []types.QueryResult{result("a.test", "192.0.2.1", 2)},
+			current:  []types.QueryResult{result("a.test", "192.0.2.1", 8)},
+		},
+		{
+			name:     "latency above the minimum delta but below the threshold",
+			baseline: []types.QueryResult{result("a.test", "192.0.2.1", 100)},
+			current:  []types.QueryResult{result("a.test", "192.0.2.1", 140)},
+		},
+		{
+			name:     "latency of a failed query is not compared",
+			baseline: []types.QueryResult{result("a.test", "NXDOMAIN", 10)},
+			current:  []types.QueryResult{result("a.test", "NXDOMAIN", 100)},
+		},
+		{
+			name:     "added and removed",
+			baseline: []types.QueryResult{result("a.test", "192.0.2.1", 10), result("old.test", "192.0.2.1", 10)},
+			current:  []types.QueryResult{result("a.test", "192.0.2.1", 10), result("new.test", "", 0)},
+			kinds:    []string{types.ChangeAdded, types.ChangeRemoved},
+		},
+		{
+			name:     "a query that appears twice is compared by its first result",
+			baseline: []types.QueryResult{result("a.test", "192.0.2.1", 10), result("a.test", "", 0)},
+			current:  []types.QueryResult{result("a.test", "", 0), result("a.test", "192.0.2.1", 10)},
+			kinds:    []string{types.ChangeNewFailure},
+			regress:  1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := test.opts
+			if opts == (CompareOptions{}) {
+				opts = defaults
+			}
+			comparison := Compare(&types.Report{Results: test.baseline}, &types.Report{Results: test.current}, opts)
+
+			var kinds []string
+			for _, change := range comparison.Changes {
+				kinds = append(kinds, change.Kind)
+			}
+			if len(kinds) != len(test.kinds) {
+				t.Fatalf("changes %v, want %v", kinds, test.kinds)
+			}
+			for i := range kinds {
+				if kinds[i] != test.kinds[i] {
+					t.Errorf("changes %v, want %v", kinds, test.kinds)
+					break
+				}
+			}
+			if comparison.Regressions != test.regress {
+				t.Errorf("%d regressions, want %d", comparison.Regressions, test.regress)
+			}
+		})
+	}
+}
+
+func TestCompareCounts(t *testing.T) {
+	baseline := []types.QueryResult{
+		result("fail.test", "192.0.2.1", 10),
+		result("recover.test", "", 0),
+		result("answers.test", "192.0.2.1", 10),
+		result("slow.test", "192.0.2.1", 10),
+		result("removed.test", "192.0.2.1", 10),
+	}
+	current := []types.QueryResult{
+		result("fail.test", "", 0),
+		result("recover.test", "192.0.2.1", 10),
+		result("answers.test", "192.0.2.2", 10),
+		result("slow.test", "192.0.2.1", 50),
+		result("added.test", "192.0.2.1", 10),
+	}
+	c := Compare(&types.Report{Results: baseline}, &types.Report{Results: current}, CompareOptions{LatencyThreshold: DefaultLatencyThreshold, LatencyMinDelta: DefaultLatencyMinDelta})
+
+	got := [...]int{c.Compared, c.NewFailures, c.Recovered, c.AnswerChanges, c.LatencyRegressions, c.Added, c.Removed, c.Regressions}
+	want := [...]int{4, 1, 1, 1, 1, 1, 1, 2}
+	if got != want {
+		t.Errorf("compared, new failures, recovered, answer changes, latency, added, removed, regressions = %v, want %v", got, want)
+	}
+	for _, change := range c.Changes {
+		if change.Kind == types.ChangeLatency && (change.BeforeTime != 10 || change.AfterTime != 50) {
+			t.Errorf("latency change from %v to %v ms, want 10 to 50", change.BeforeTime, change.AfterTime)
+		}
+	}
+}
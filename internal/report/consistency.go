@@ -0,0 +1,157 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"dnstester/pkg/types"
+)
+
+// MajorityReference is the ConsistencyGroup.Reference used when answers are compared to the most
+// common answer set rather than to a reference server.
+const MajorityReference = "majority"
+
+// AnalyzeConsistency groups results by domain and query type and flags the server/protocol results
+// whose answer set differs from the reference server's, or from the majority when reference is empty
+// or the reference server has no result in the group. TTLs and record order are ignored, DNS error
+// responses compare by rcode, and results without a response are left out. Only groups with at least
+// two entries are returned, in the order they first appear in results.
+func AnalyzeConsistency(results []types.QueryResult, reference string) []types.ConsistencyGroup {
+	var groups []types.ConsistencyGroup
+	index := make(map[string]int)
+
+	for _, result := range results {
+		if result.Rcode == "" {
+			continue
+		}
+		key := strings.ToLower(result.Domain) + "/" + result.QueryType
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, types.ConsistencyGroup{Domain: result.Domain, QueryType: result.QueryType})
+		}
+		groups[i].Entries = append(groups[i].Entries, types.ConsistencyEntry{
+			ServerName: result.ServerName,
+			Protocol:   result.Protocol,
+			AnswerSet:  answerSet(result),
+		})
+	}
+
+	compared := groups[:0]
+	for _, group := range groups {
+		if len(group.Entries) < 2 {
+			continue
+		}
+		group.Reference, group.Expected = expectedAnswerSet(group.Entries, reference)
+		group.Consistent = true
+		for i := range group.Entries {
+			if group.Entries[i].AnswerSet != group.Expected {
+				group.Entries[i].Diverges = true
+				group.Consistent = false
+			}
+		}
+		compared = append(compared, group)
+	}
+	return compared
+}
+
+// answerSet renders a result's answers as a canonical, sorted string, or its rcode when not NOERROR.
+func answerSet(result types.QueryResult) string {
+	if result.Rcode != "NOERROR" {
+		return result.Rcode
+	}
+	if len(result.Answers) == 0 {
+		return "NODATA"
+	}
+	answers := make([]string, len(result.Answers))
+	for i, answer := range result.Answers {
+		answers[i] = answer.Type + " " + answer.Data
+	}
+	sort.Strings(answers)
+	return strings.Join(answers, ", ")
+}
+
+// expectedAnswerSet returns the reference server's most common answer set if it is in the group, and
+// otherwise the group's most common answer set. Ties go to the set seen first.
+func expectedAnswerSet(entries []types.ConsistencyEntry, reference string) (string, string) {
+	if reference != "" {
+		var fromReference []types.ConsistencyEntry
+		for _, entry := range entries {
+			if entry.ServerName == reference {
+				fromReference = append(fromReference, entry)
+			}
+		}
+		if len(fromReference) > 0 {
+			return reference, mostCommon(fromReference)
+		}
+	}
+	return MajorityReference, mostCommon(entries)
+}
+
+// mostCommon returns the answer set shared by the most entries.
+func mostCommon(entries []types.ConsistencyEntry) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, entry := range entries {
+		counts[entry.AnswerSet]++
+		if counts[entry.AnswerSet] > counts[best] {
+			best = entry.AnswerSet
+		}
+	}
+	return best
+}
+
+// divergentCount returns the number of entries in a group that differ from the expected set.
+func divergentCount(group types.ConsistencyGroup) int {
+	count := 0
+	for _, entry := range group.Entries {
+		if entry.Diverges {
+			count++
+		}
+	}
+	return count
+}
+
+// consistencyStatus summarises a group, e.g. "✓ 4 agree" or "✗ 1 of 4 diverge".
+func consistencyStatus(group types.ConsistencyGroup) string {
+	if group.Consistent {
+		return fmt.Sprintf("✓ %d agree", len(group.Entries))
+	}
+	return fmt.Sprintf("✗ %d of %d diverge", divergentCount(group), len(group.Entries))
+}
+
+// writeConsistency writes the per-domain divergence table. Consistent groups take one row; divergent
+// groups list the expected answer set followed by each diverging server/protocol.
+func writeConsistency(writer io.Writer, groups []types.ConsistencyGroup) {
+	if len(groups) == 0 {
+		return
+	}
+
+	fmt.Fprintf(writer, "\nAnswer Consistency\n")
+	fmt.Fprintf(writer, "==================\n\n")
+
+	tw := tabwriter.NewWriter(writer, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "Domain\tType\tStatus\tServer\tProtocol\tAnswers")
+	fmt.Fprintln(tw, "------\t----\t------\t------\t--------\t-------")
+
+	for _, group := range groups {
+		reference := group.Reference
+		if reference == MajorityReference {
+			reference = fmt.Sprintf("(majority of %d)", len(group.Entries))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			group.Domain, group.QueryType, consistencyStatus(group), reference, "-", group.Expected)
+
+		for _, entry := range group.Entries {
+			if entry.Diverges {
+				fmt.Fprintf(tw, "\t\t%s\t%s\t%s\t%s\n", "✗ diverges", entry.ServerName, entry.Protocol, entry.AnswerSet)
+			}
+		}
+	}
+
+	tw.Flush()
+}
@@ -0,0 +1,64 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"dnstester/pkg/types"
+)
+
+// generateJSONReport writes a report, such as the full test report with results, summary and consistency,
+// as one indented JSON document.
+func generateJSONReport(writer io.Writer, report any) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("failed to write JSON report: %w", err)
+	}
+	return nil
+}
+
+// generateNDJSONReport writes one JSON result per line, in result order.
+func generateNDJSONReport(writer io.Writer, report *types.Report) error {
+	encoder := json.NewEncoder(writer)
+	for _, result := range report.Results {
+		if err := encoder.Encode(result); err != nil {
+			return fmt.Errorf("failed to write NDJSON result: %w", err)
+		}
+	}
+	return nil
+}
+
+// NDJSONWriter streams results as newline-delimited JSON while queries complete, one result per line.
+// It is not safe for concurrent use; runner.Options.OnResult calls are already serialized.
+type NDJSONWriter struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewNDJSONWriter creates outputFile for streaming, or streams to stdout if it is empty.
+func NewNDJSONWriter(outputFile string) (*NDJSONWriter, error) {
+	file, err := createOutput(outputFile)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONWriter{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Write writes a single result as one line of JSON.
+func (w *NDJSONWriter) Write(result types.QueryResult) error {
+	if err := w.encoder.Encode(result); err != nil {
+		return fmt.Errorf("failed to write NDJSON result: %w", err)
+	}
+	return nil
+}
+
+// Close closes the output file; stdout is left open.
+func (w *NDJSONWriter) Close() error {
+	if w.file == os.Stdout {
+		return nil
+	}
+	return w.file.Close()
+}
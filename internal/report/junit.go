@@ -0,0 +1,145 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"dnstester/pkg/types"
+)
+
+// junitTestSuites is the root element of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the queries sent to one server.
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+
+	totalTime float64
+}
+
+// junitTestCase is a single domain/query type/protocol query.
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+// junitOutput holds the answers of a query as the testcase's system-out.
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// junitFailure describes why a query failed or did not meet its expectations.
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+// generateJUnitReport writes a JUnit XML report with one testsuite per server, in the order servers first
+// appear in the results, and one testcase per query. A query fails on a transport or DNS error and on
+// failed assertions; both are reported in the same failure element.
+func generateJUnitReport(writer io.Writer, report *types.Report) error {
+	root := junitTestSuites{Name: "dnstester"}
+	index := make(map[string]int)
+	var totalTime float64
+
+	for _, result := range report.Results {
+		i, ok := index[result.ServerName]
+		if !ok {
+			i = len(root.Suites)
+			index[result.ServerName] = i
+			root.Suites = append(root.Suites, junitTestSuite{Name: result.ServerName})
+		}
+		suite := &root.Suites[i]
+
+		testCase := junitTestCase{
+			Name:      fmt.Sprintf("%s %s via %s", result.Domain, result.QueryType, result.Protocol),
+			ClassName: result.ServerName,
+			Time:      junitSeconds(result.ResponseTime),
+			Failure:   junitFailureFor(result),
+		}
+		if answers := FormatAnswers(result.Answers, "\n"); answers != "" {
+			testCase.SystemOut = &junitOutput{Text: answers}
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+		suite.Tests++
+		root.Tests++
+		if testCase.Failure != nil {
+			suite.Failures++
+			root.Failures++
+		}
+		if result.ResponseTime > 0 {
+			suite.totalTime += result.ResponseTime
+			totalTime += result.ResponseTime
+		}
+	}
+
+	for i := range root.Suites {
+		root.Suites[i].Time = junitSeconds(root.Suites[i].totalTime)
+	}
+	root.Time = junitSeconds(totalTime)
+
+	if _, err := io.WriteString(writer, xml.Header); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(root); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	if _, err := io.WriteString(writer, "\n"); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	return nil
+}
+
+// junitFailureFor returns the failure element for a result, or nil if it passed. The message is the query
+// error or the first assertion failure; the body lists every error and, for queries that received a
+// response, every assertion failure.
+func junitFailureFor(result types.QueryResult) *junitFailure {
+	assertionFailed := result.Assertion != nil && !result.Assertion.Passed
+
+	switch {
+	case !result.Success && !assertionFailed && result.Assertion != nil:
+		// An expected error response (e.g. NXDOMAIN) passed its assertion
+		return nil
+	case !result.Success:
+		failure := &junitFailure{Message: result.Error, Type: "QueryFailed", Text: formatError(result)}
+		if assertionFailed && result.Rcode != "" {
+			failure.Text += "\nassertion: " + strings.Join(result.Assertion.Failures, "\nassertion: ")
+		}
+		return failure
+	case assertionFailed:
+		return &junitFailure{
+			Message: result.Assertion.Failures[0],
+			Type:    "AssertionFailed",
+			Text:    strings.Join(result.Assertion.Failures, "\n"),
+		}
+	}
+	return nil
+}
+
+// junitSeconds converts milliseconds to the seconds value used in JUnit time attributes.
+func junitSeconds(milliseconds float64) string {
+	if milliseconds < 0 {
+		milliseconds = 0
+	}
+	return fmt.Sprintf("%.6f", milliseconds/1000)
+}
@@ -0,0 +1,65 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"dnstester/pkg/types"
+)
+
+// GenerateMonitorReport writes the status of monitor targets as text or JSON. If outputFile is empty,
+// writes to stdout.
+func GenerateMonitorReport(statuses []types.TargetStatus, outputFile string, format string) error {
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("invalid monitor report format '%s' (valid formats: %s, %s)", format, FormatText, FormatJSON)
+	}
+
+	writer, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	if writer != os.Stdout {
+		defer writer.Close()
+	}
+
+	if format == FormatJSON {
+		return generateJSONReport(writer, statuses)
+	}
+
+	fmt.Fprintf(writer, "DNS Monitor Status\n")
+	fmt.Fprintf(writer, "==================\n\n")
+
+	up, down := 0, 0
+	for _, status := range statuses {
+		switch status.State {
+		case types.StateUp:
+			up++
+		case types.StateDown:
+			down++
+		}
+	}
+	fmt.Fprintf(writer, "Targets:          %d\n", len(statuses))
+	fmt.Fprintf(writer, "Up:               %d\n", up)
+	fmt.Fprintf(writer, "Down:             %d\n", down)
+	fmt.Fprintf(writer, "Unknown:          %d\n\n", len(statuses)-up-down)
+
+	tw := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Server\tDomain\tType\tProtocol\tState\tSince\tChecks\tFailures\tAvailability\tAvg (ms)\tP95 (ms)\tLast Error")
+	fmt.Fprintln(tw, "------\t------\t----\t--------\t-----\t-----\t------\t--------\t------------\t--------\t--------\t----------")
+	for _, status := range statuses {
+		since := "-"
+		if !status.Since.IsZero() {
+			since = status.Since.Format(time.DateTime)
+		}
+		lastError := status.LastError
+		if lastError == "" {
+			lastError = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%.1f%%\t%.3f\t%.3f\t%s\n",
+			status.ServerName, status.Domain, status.QueryType, status.Protocol, status.State, since,
+			status.Checks, status.Failures, status.Availability*100, status.Latency.Average, status.Latency.P95, lastError)
+	}
+	return tw.Flush()
+}
@@ -3,6 +3,7 @@ package report
 import (
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"text/tabwriter"
@@ -10,29 +11,61 @@ import (
 	"dnstester/pkg/types"
 )
 
-// GenerateReport generates a formatted report. Uses text/tabwriter for text format and encoding/csv for CSV.
-// If outputFile is empty, writes to stdout. CSV format uses semicolon-separated IPs.
-func GenerateReport(results []types.QueryResult, outputFile string, csvFormat bool) error {
+// Report formats accepted by GenerateReport
+const (
+	FormatText   = "text"
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatJUnit  = "junit"
+)
+
+// ValidateFormat checks that format is one of the supported report formats.
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatText, FormatCSV, FormatJSON, FormatNDJSON, FormatJUnit:
+		return nil
+	}
+	return fmt.Errorf("invalid report format '%s' (valid formats: %s, %s, %s, %s, %s)", format, FormatText, FormatCSV, FormatJSON, FormatNDJSON, FormatJUnit)
+}
+
+// GenerateReport generates a report in the given format. Uses text/tabwriter for text format, encoding/csv
+// for CSV, encoding/json for JSON and NDJSON, and encoding/xml for JUnit. If outputFile is empty, writes to stdout. CSV format uses
+// semicolon-separated answers. Answer sets are compared against the reference server, or the majority when
+// reference is empty (see AnalyzeConsistency).
+func GenerateReport(results []types.QueryResult, outputFile string, format string, reference string) error {
+	if err := ValidateFormat(format); err != nil {
+		return err
+	}
+
 	report := &types.Report{
-		Results: results,
-		Summary: CalculateSummary(results),
+		Results:     results,
+		Summary:     CalculateSummary(results),
+		Consistency: AnalyzeConsistency(results, reference),
 	}
 
 	// Create output file or use stdout if not specificed
-	var writer *os.File
-	var err error
-	if outputFile != "" {
-		writer, err = os.Create(outputFile)
-		if err != nil {
-			return fmt.Errorf("failed to create output file: %w", err)
-		}
+	writer, err := createOutput(outputFile)
+	if err != nil {
+		return err
+	}
+	if writer != os.Stdout {
 		defer writer.Close()
-	} else {
-		writer = os.Stdout
 	}
+	return WriteReport(writer, report, format)
+}
 
-	if csvFormat {
+// WriteReport writes a report to writer in the given format (see GenerateReport).
+func WriteReport(writer io.Writer, report *types.Report, format string) error {
+	switch format {
+	case FormatCSV:
 		return generateCSVReport(writer, report)
+	case FormatJSON:
+		return generateJSONReport(writer, report)
+	case FormatNDJSON:
+		return generateNDJSONReport(writer, report)
+	case FormatJUnit:
+		return generateJUnitReport(writer, report)
 	}
 
 	// Write report header
@@ -40,26 +73,29 @@ func GenerateReport(results []types.QueryResult, outputFile string, csvFormat bo
 	fmt.Fprintf(writer, "==================\n\n")
 
 	writeSummary(writer, report.Summary)
+	writeBreakdowns(writer, report.Summary)
 
 	fmt.Fprintf(writer, "\nDetailed Results\n")
 	fmt.Fprintf(writer, "================\n\n")
 
 	tw := tabwriter.NewWriter(writer, 0, 0, 3, ' ', 0)
-	fmt.Fprintln(tw, "Server\tAddress\tDomain\tProtocol\tResponse IPs\tTime (ms)\tStatus\tError")
-	fmt.Fprintln(tw, "------\t-------\t------\t--------\t------------\t---------\t------\t-----")
+	fmt.Fprintln(tw, "Server\tAddress\tDomain\tType\tProtocol\tInstance\tAnswers\tTime (ms)\tDNS (ms)\tConnect (ms)\tTLS (ms)\tHTTP (ms)\tExchange (ms)\tAttempts\tDNSSEC\tStatus\tAssertion\tError")
+	fmt.Fprintln(tw, "------\t-------\t------\t----\t--------\t--------\t-------\t---------\t--------\t------------\t--------\t---------\t-------------\t--------\t------\t------\t---------\t-----")
 
-	for _, result := range results {
+	for _, result := range report.Results {
 		status := "✓"
-		if !result.Success {
+		if result.Retried() {
+			status = "✓ (retry)"
+		} else if !result.Success {
 			status = "✗"
 		}
 
-		ips := strings.Join(result.ResponseIPs, ", ")
-		if ips == "" {
-			ips = "N/A"
+		answers := FormatAnswers(result.Answers, ", ")
+		if answers == "" {
+			answers = "N/A"
 		}
 
-		errorMsg := result.Error
+		errorMsg := formatError(result)
 		if errorMsg == "" {
 			errorMsg = "-"
 		}
@@ -70,48 +106,71 @@ func GenerateReport(results []types.QueryResult, outputFile string, csvFormat bo
 			responseTime = 0
 		}
 
-		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%.3f\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
 			result.ServerName,
 			result.ServerAddress,
 			result.Domain,
+			result.QueryType,
 			result.Protocol,
-			ips,
+			formatInstance(result),
+			answers,
 			responseTime,
+			formatPhase(result.Timing.DNSLookup),
+			formatPhase(result.Timing.Connect),
+			formatPhase(result.Timing.TLSHandshake),
+			formatPhase(result.Timing.HTTP),
+			formatPhase(result.Timing.Exchange),
+			result.Attempts,
+			formatDNSSEC(result),
 			status,
+			formatAssertion(result.Assertion, "✓", "✗ "),
 			errorMsg,
 		)
 	}
 
 	tw.Flush()
 
+	writeConsistency(writer, report.Consistency)
+
 	return nil
 }
 
-// generateCSVReport writes a CSV report using encoding/csv. Response IPs are semicolon-separated.
-func generateCSVReport(writer *os.File, report *types.Report) error {
+// createOutput creates outputFile, or returns stdout if it is empty.
+func createOutput(outputFile string) (*os.File, error) {
+	if outputFile == "" {
+		return os.Stdout, nil
+	}
+	writer, err := os.Create(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return writer, nil
+}
+
+// generateCSVReport writes a CSV report using encoding/csv. Answers are semicolon-separated.
+func generateCSVReport(writer io.Writer, report *types.Report) error {
 	csvWriter := csv.NewWriter(writer)
 	defer csvWriter.Flush()
 
-	header := []string{"Server", "Address", "Domain", "Protocol", "Response IPs", "Time (ms)", "Status", "Error"}
+	header := []string{"Server", "Address", "Domain", "Type", "Protocol", "Instance", "Answers", "Time (ms)", "DNS (ms)", "Connect (ms)", "TLS (ms)", "HTTP (ms)", "Exchange (ms)", "Attempts", "DNSSEC", "Status", "Assertion", "Error"}
 	if err := csvWriter.Write(header); err != nil {
 		return fmt.Errorf("failed to write CSV header: %w", err)
 	}
 
 	for _, result := range report.Results {
 		status := "Success"
-		if !result.Success {
+		if result.Retried() {
+			status = "Success after retry"
+		} else if !result.Success {
 			status = "Failed"
 		}
 
-		ips := strings.Join(result.ResponseIPs, "; ")
-		if ips == "" {
-			ips = "N/A"
+		answers := FormatAnswers(result.Answers, "; ")
+		if answers == "" {
+			answers = "N/A"
 		}
 
-		errorMsg := result.Error
-		if errorMsg == "" {
-			errorMsg = ""
-		}
+		errorMsg := formatError(result)
 
 		responseTime := result.ResponseTime
 		if responseTime < 0 {
@@ -122,10 +181,20 @@ func generateCSVReport(writer *os.File, report *types.Report) error {
 			result.ServerName,
 			result.ServerAddress,
 			result.Domain,
+			result.QueryType,
 			result.Protocol,
-			ips,
-			fmt.Sprintf("%d", responseTime),
+			formatInstance(result),
+			answers,
+			fmt.Sprintf("%.3f", responseTime),
+			formatPhase(result.Timing.DNSLookup),
+			formatPhase(result.Timing.Connect),
+			formatPhase(result.Timing.TLSHandshake),
+			formatPhase(result.Timing.HTTP),
+			formatPhase(result.Timing.Exchange),
+			fmt.Sprintf("%d", result.Attempts),
+			formatDNSSEC(result),
 			status,
+			formatAssertion(result.Assertion, "Passed", "Failed: "),
 			errorMsg,
 		}
 
@@ -137,23 +206,152 @@ func generateCSVReport(writer *os.File, report *types.Report) error {
 	return nil
 }
 
-// CalculateSummary calculates aggregate statistics. Only successful queries are included in timing calculations.
-// MinTime is initialized to -1 to distinguish "no successful queries" from "min time is 0ms".
+// formatError returns the final error of a failed query, or for a query that succeeded after retrying,
+// the errors of the earlier attempts. Extended DNS Errors, the reason a validated answer is not secure
+// and failed cookie and padding checks are appended.
+func formatError(result types.QueryResult) string {
+	var parts []string
+	if result.Retried() {
+		parts = append(parts, "earlier attempts: "+strings.Join(result.AttemptErrors, "; "))
+	} else if result.Error != "" {
+		parts = append(parts, result.Error)
+	}
+	for _, ede := range result.ExtendedErrors {
+		parts = append(parts, ede.String())
+	}
+	if result.DNSSECReason != "" {
+		parts = append(parts, "dnssec: "+result.DNSSECReason)
+	}
+	if result.CookieStatus != "" && result.CookieStatus != types.CookieValid {
+		parts = append(parts, "cookie: "+result.CookieStatus)
+	}
+	if result.PaddingStatus == types.Unpadded {
+		parts = append(parts, "padding: response not padded")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// formatAssertion renders an assertion outcome as passed, or as failed followed by the failure
+// messages. Results without expectations render as "-".
+func formatAssertion(assertion *types.AssertionResult, passed string, failedPrefix string) string {
+	if assertion == nil {
+		return "-"
+	}
+	if assertion.Passed {
+		return passed
+	}
+	return failedPrefix + strings.Join(assertion.Failures, "; ")
+}
+
+// formatDNSSEC renders the local validation status and the AD flag, e.g. "secure (AD)", or "-".
+func formatDNSSEC(result types.QueryResult) string {
+	switch {
+	case result.DNSSECStatus != "" && result.Flags.AD:
+		return result.DNSSECStatus + " (AD)"
+	case result.DNSSECStatus != "":
+		return result.DNSSECStatus
+	case result.Flags.AD:
+		return "AD"
+	default:
+		return "-"
+	}
+}
+
+// formatInstance renders the server instance that answered, "unidentified" if the server did not
+// identify itself, or "-" for servers without identify.
+func formatInstance(result types.QueryResult) string {
+	switch {
+	case result.Instance != "":
+		return result.Instance
+	case result.InstanceSource != "":
+		return "unidentified"
+	default:
+		return "-"
+	}
+}
+
+// formatPhase renders a timing phase in milliseconds, or "-" for phases the query did not go through.
+func formatPhase(milliseconds float64) string {
+	if milliseconds <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", milliseconds)
+}
+
+// FormatAnswer renders an answer as "TYPE rdata (TTL s)", e.g. "MX 10 mail.example.com. (300s)".
+func FormatAnswer(answer types.Answer) string {
+	return fmt.Sprintf("%s %s (%ds)", answer.Type, answer.Data, answer.TTL)
+}
+
+// FormatAnswers renders answers with FormatAnswer, joined by sep. Returns "" when there are none.
+func FormatAnswers(answers []types.Answer, sep string) string {
+	formatted := make([]string, len(answers))
+	for i, answer := range answers {
+		formatted[i] = FormatAnswer(answer)
+	}
+	return strings.Join(formatted, sep)
+}
+
+// CalculateSummary calculates aggregate statistics, with breakdowns by server, protocol, domain,
+// server × protocol and, for servers with identify, server instance. Only successful queries are
+// included in timing calculations.
 func CalculateSummary(results []types.QueryResult) types.Summary {
+	summary := summarize(results)
+	summary.ByServer = groupSummaries(results, func(r types.QueryResult) types.GroupSummary {
+		return types.GroupSummary{Server: r.ServerName}
+	})
+	summary.ByProtocol = groupSummaries(results, func(r types.QueryResult) types.GroupSummary {
+		return types.GroupSummary{Protocol: r.Protocol}
+	})
+	summary.ByDomain = groupSummaries(results, func(r types.QueryResult) types.GroupSummary {
+		return types.GroupSummary{Domain: r.Domain}
+	})
+	summary.ByServerProtocol = groupSummaries(results, func(r types.QueryResult) types.GroupSummary {
+		return types.GroupSummary{Server: r.ServerName, Protocol: r.Protocol}
+	})
+
+	var identified []types.QueryResult
+	for _, result := range results {
+		if result.InstanceSource != "" {
+			identified = append(identified, result)
+		}
+	}
+	summary.ByInstance = groupSummaries(identified, func(r types.QueryResult) types.GroupSummary {
+		return types.GroupSummary{Server: r.ServerName, Instance: r.Instance}
+	})
+	return summary
+}
+
+// summarize calculates the statistics of one set of results, without breakdowns. MinTime is initialized
+// to -1 to distinguish "no successful queries" from "min time is 0ms".
+func summarize(results []types.QueryResult) types.Summary {
 	summary := types.Summary{
 		TotalQueries: len(results),
 		MinTime:      -1,
 		MaxTime:      0,
 	}
 
-	var totalTime int64
+	var totalTime float64
 	var successfulCount int
+	var times []float64
 
 	for _, result := range results {
+		if result.Assertion != nil {
+			if result.Assertion.Passed {
+				summary.AssertionsPassed++
+			} else {
+				summary.AssertionsFailed++
+			}
+		}
+
 		if result.Success {
 			summary.Successful++
+			if result.Retried() {
+				summary.Retried++
+			}
 			successfulCount++
 			totalTime += result.ResponseTime
+			times = append(times, result.ResponseTime)
 
 			if summary.MinTime == -1 || result.ResponseTime < summary.MinTime {
 				summary.MinTime = result.ResponseTime
@@ -168,20 +366,28 @@ func CalculateSummary(results []types.QueryResult) types.Summary {
 
 	if successfulCount > 0 {
 		summary.AverageTime = float64(totalTime) / float64(successfulCount)
+		setDistribution(&summary, times)
 	}
 
 	return summary
 }
 
-func writeSummary(writer *os.File, summary types.Summary) {
+func writeSummary(writer io.Writer, summary types.Summary) {
 	fmt.Fprintf(writer, "Summary\n")
 	fmt.Fprintf(writer, "-------\n")
 	fmt.Fprintf(writer, "Total Queries:    %d\n", summary.TotalQueries)
 	fmt.Fprintf(writer, "Successful:       %d\n", summary.Successful)
 	fmt.Fprintf(writer, "Failed:           %d\n", summary.Failed)
+	fmt.Fprintf(writer, "After Retry:      %d\n", summary.Retried)
+	if summary.AssertionsPassed+summary.AssertionsFailed > 0 {
+		fmt.Fprintf(writer, "Assertions:       %d passed, %d failed\n", summary.AssertionsPassed, summary.AssertionsFailed)
+	}
 	if summary.Successful > 0 {
-		fmt.Fprintf(writer, "Average Time:     %.2f ms\n", summary.AverageTime)
-		fmt.Fprintf(writer, "Min Time:         %d ms\n", summary.MinTime)
-		fmt.Fprintf(writer, "Max Time:         %d ms\n", summary.MaxTime)
+		fmt.Fprintf(writer, "Average Time:     %.3f ms\n", summary.AverageTime)
+		fmt.Fprintf(writer, "Min Time:         %.3f ms\n", summary.MinTime)
+		fmt.Fprintf(writer, "Max Time:         %.3f ms\n", summary.MaxTime)
+		fmt.Fprintf(writer, "Percentiles:      p50 %.3f ms, p90 %.3f ms, p95 %.3f ms, p99 %.3f ms\n",
+			summary.P50Time, summary.P90Time, summary.P95Time, summary.P99Time)
+		fmt.Fprintf(writer, "Std Deviation:    %.3f ms\n", summary.StdDevTime)
 	}
 }
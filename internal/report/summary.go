@@ -0,0 +1,192 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+
+	"dnstester/pkg/types"
+)
+
+// setDistribution sets the percentiles and standard deviation of the successful response times.
+func setDistribution(summary *types.Summary, times []float64) {
+	latency := Latency(times)
+	summary.P50Time = latency.P50
+	summary.P90Time = latency.P90
+	summary.P95Time = latency.P95
+	summary.P99Time = latency.P99
+	summary.StdDevTime = latency.StdDev
+}
+
+// Latency calculates the average, extremes, percentiles and standard deviation of response times in
+// milliseconds. All fields are 0 when times is empty.
+func Latency(times []float64) types.LatencyStats {
+	var stats types.LatencyStats
+	if len(times) == 0 {
+		return stats
+	}
+
+	sorted := append([]float64(nil), times...)
+	sort.Float64s(sorted)
+
+	var total float64
+	for _, t := range sorted {
+		total += t
+	}
+	stats.Average = total / float64(len(sorted))
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	stats.P50 = percentile(sorted, 50)
+	stats.P90 = percentile(sorted, 90)
+	stats.P95 = percentile(sorted, 95)
+	stats.P99 = percentile(sorted, 99)
+
+	var variance float64
+	for _, t := range sorted {
+		d := t - stats.Average
+		variance += d * d
+	}
+	stats.StdDev = math.Sqrt(variance / float64(len(sorted)))
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted values, interpolating linearly between the two
+// closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	fraction := rank - float64(lower)
+	return sorted[lower] + fraction*(sorted[upper]-sorted[lower])
+}
+
+// groupSummaries summarizes results grouped by the key that keyOf returns, in the order keys first
+// appear in results.
+func groupSummaries(results []types.QueryResult, keyOf func(types.QueryResult) types.GroupSummary) []types.GroupSummary {
+	var groups []types.GroupSummary
+	var members [][]types.QueryResult
+	index := make(map[[4]string]int)
+
+	for _, result := range results {
+		group := keyOf(result)
+		key := [4]string{group.Server, group.Protocol, group.Domain, group.Instance}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, group)
+			members = append(members, nil)
+		}
+		members[i] = append(members[i], result)
+	}
+
+	for i := range groups {
+		groups[i].Summary = summarize(members[i])
+	}
+	return groups
+}
+
+// groupLabel names a group in reports, e.g. "Cloudflare", "dot", "Cloudflare / dot" or
+// "Cloudflare / syd1".
+func groupLabel(group types.GroupSummary) string {
+	switch {
+	case group.Instance != "":
+		return group.Server + " / " + group.Instance
+	case group.Server != "" && group.Protocol != "":
+		return group.Server + " / " + group.Protocol
+	case group.Server != "":
+		return group.Server
+	case group.Protocol != "":
+		return group.Protocol
+	default:
+		return group.Domain
+	}
+}
+
+// breakdown is a grouping dimension of a summary: its section title in text reports, its name and
+// its groups.
+type breakdown struct {
+	title     string
+	dimension string
+	groups    []types.GroupSummary
+}
+
+// breakdowns lists the grouped summaries of a summary.
+func breakdowns(summary types.Summary) []breakdown {
+	return []breakdown{
+		{"Server", "server", summary.ByServer},
+		{"Protocol", "protocol", summary.ByProtocol},
+		{"Server × Protocol", "server_protocol", summary.ByServerProtocol},
+		{"Domain", "domain", summary.ByDomain},
+		{"Instance", "instance", summary.ByInstance},
+	}
+}
+
+// formatTime renders a timing statistic of a group, or "-" when it had no successful queries.
+func formatTime(summary types.Summary, value float64) string {
+	if summary.Successful == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", value)
+}
+
+// breakdownRow returns the counts and timing statistics of a group as report cells.
+func breakdownRow(summary types.Summary) []string {
+	minTime, maxTime := "-", "-"
+	if summary.Successful > 0 {
+		minTime = fmt.Sprintf("%.3f", summary.MinTime)
+		maxTime = fmt.Sprintf("%.3f", summary.MaxTime)
+	}
+	return []string{
+		fmt.Sprintf("%d", summary.TotalQueries),
+		fmt.Sprintf("%d", summary.Successful),
+		fmt.Sprintf("%d", summary.Failed),
+		formatTime(summary, summary.AverageTime),
+		minTime,
+		maxTime,
+		formatTime(summary, summary.P50Time),
+		formatTime(summary, summary.P90Time),
+		formatTime(summary, summary.P95Time),
+		formatTime(summary, summary.P99Time),
+		formatTime(summary, summary.StdDevTime),
+	}
+}
+
+// breakdownHeader names the columns of breakdownRow.
+var breakdownHeader = []string{"Queries", "Successful", "Failed", "Avg (ms)", "Min (ms)", "Max (ms)", "P50 (ms)", "P90 (ms)", "P95 (ms)", "P99 (ms)", "StdDev (ms)"}
+
+// writeBreakdowns writes one table per grouping dimension. Dimensions with a single group are skipped
+// since they repeat the overall summary, except instances, which name the instance that answered.
+func writeBreakdowns(writer io.Writer, summary types.Summary) {
+	for _, breakdown := range breakdowns(summary) {
+		instances := breakdown.dimension == "instance"
+		if len(breakdown.groups) == 0 || len(breakdown.groups) == 1 && !instances {
+			continue
+		}
+
+		fmt.Fprintf(writer, "\nBy %s\n", breakdown.title)
+		tw := tabwriter.NewWriter(writer, 0, 0, 3, ' ', 0)
+		fmt.Fprint(tw, breakdown.title)
+		for _, column := range breakdownHeader {
+			fmt.Fprint(tw, "\t"+column)
+		}
+		fmt.Fprintln(tw)
+		for _, group := range breakdown.groups {
+			label := groupLabel(group)
+			if instances && group.Instance == "" {
+				label += " / unidentified"
+			}
+			fmt.Fprint(tw, label)
+			for _, cell := range breakdownRow(group.Summary) {
+				fmt.Fprint(tw, "\t"+cell)
+			}
+			fmt.Fprintln(tw)
+		}
+		tw.Flush()
+	}
+}
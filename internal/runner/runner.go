@@ -0,0 +1,222 @@
+package runner
+
+import (
+	"context"
+	"sync"
+
+	"dnstester/internal/config"
+	"dnstester/internal/dns"
+	"dnstester/internal/expect"
+	"dnstester/pkg/types"
+)
+
+// DefaultConcurrency is the global number of queries in flight when none is configured.
+const DefaultConcurrency = 10
+
+// Job is a single query in the test matrix.
+type Job struct {
+	Server    types.Server
+	Domain    types.Domain
+	Protocol  string
+	QueryType string
+}
+
+// Options controls how Run executes jobs.
+type Options struct {
+	// Concurrency is the maximum number of queries in flight overall. Values <= 0 use DefaultConcurrency.
+	Concurrency int
+	// OnResult, if set, is called once per job as it completes. Calls are serialized but arrive in
+	// completion order, not job order.
+	OnResult func(job Job, result types.QueryResult)
+}
+
+// Plan expands the server × domain × protocol × query type matrix of cfg into jobs, in the order
+// results are reported. Each job's Server carries the effective settings for that domain.
+func Plan(cfg *types.Config) []Job {
+	var jobs []Job
+	for _, configured := range cfg.Servers {
+		for _, domain := range cfg.Domains {
+			server := configured
+			if domain.DNSSEC != nil {
+				server.DNSSEC = domain.DNSSEC
+			}
+			if domain.EDNS != nil {
+				server.EDNS = domain.EDNS
+			}
+			queryTypes := config.QueryTypesFor(cfg.QueryTypes, server, domain)
+			for _, protocol := range server.Protocols {
+				for _, queryType := range queryTypes {
+					jobs = append(jobs, Job{
+						Server:    server,
+						Domain:    domain,
+						Protocol:  protocol,
+						QueryType: queryType,
+					})
+				}
+			}
+		}
+	}
+	return jobs
+}
+
+// Run executes jobs on a bounded worker pool and returns one result per job, in job order regardless
+// of completion order. Besides the global limit in opts, queries to a server never exceed that
+// server's max_concurrency (0 means no per-server limit). Workers only take jobs for servers below
+// their limit, so a slow server cannot hold workers that other servers could use. Jobs not started
+// before ctx is cancelled are reported as failed with the context error.
+func Run(ctx context.Context, jobs []Job, opts Options) []types.QueryResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	// Servers with identify are probed once per run, not after every response
+	ctx = dns.WithInstances(ctx, dns.NewInstances())
+
+	results := make([]types.QueryResult, len(jobs))
+	sched := newScheduler(jobs)
+	stop := context.AfterFunc(ctx, sched.cancel)
+	defer stop()
+
+	var wg sync.WaitGroup
+	var resultMu sync.Mutex
+	for w := 0; w < concurrency && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i, ok := sched.next()
+				if !ok {
+					return
+				}
+				result := runJob(ctx, jobs[i])
+				sched.done(i)
+				results[i] = result
+				if opts.OnResult != nil {
+					resultMu.Lock()
+					opts.OnResult(jobs[i], result)
+					resultMu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runJob performs the query of a job and checks the result against the domain's expectations.
+func runJob(ctx context.Context, job Job) types.QueryResult {
+	if err := ctx.Err(); err != nil {
+		return canceledResult(job, err)
+	}
+	result := dns.Query(ctx, job.Server, job.Domain.Name, job.Protocol, job.QueryType)
+	if job.Domain.Expect != nil {
+		result.Assertion = expect.Evaluate(*job.Domain.Expect, result)
+	}
+	return result
+}
+
+// canceledResult reports a job that was never sent.
+func canceledResult(job Job, err error) types.QueryResult {
+	return types.QueryResult{
+		ServerName:    job.Server.Name,
+		ServerAddress: job.Server.Address,
+		Domain:        job.Domain.Name,
+		QueryType:     job.QueryType,
+		Protocol:      job.Protocol,
+		Answers:       []types.Answer{},
+		ResponseIPs:   []string{},
+		Authority:     []types.Answer{},
+		Additional:    []types.Answer{},
+		Error:         err.Error(),
+
+		ExtendedErrors: []types.ExtendedError{},
+	}
+}
+
+// scheduler hands out jobs to workers in job order, skipping servers that have max_concurrency
+// queries in flight until one of them completes.
+type scheduler struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	jobs     []Job
+	pending  map[string][]int // job indexes not yet started, per server
+	servers  []string         // server keys in the order they first appear in jobs
+	inFlight map[string]int
+	left     int
+	// cancelled is set once the run's context is done; limits no longer apply then
+	cancelled bool
+}
+
+func newScheduler(jobs []Job) *scheduler {
+	s := &scheduler{
+		jobs:     jobs,
+		pending:  make(map[string][]int),
+		inFlight: make(map[string]int),
+		left:     len(jobs),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i, job := range jobs {
+		key := serverKey(job.Server)
+		if _, ok := s.pending[key]; !ok {
+			s.servers = append(s.servers, key)
+		}
+		s.pending[key] = append(s.pending[key], i)
+	}
+	return s
+}
+
+// next returns the earliest pending job whose server is below its limit, waiting while every server
+// with pending jobs is at its limit. Once cancelled, limits no longer apply, so the remaining jobs are
+// handed out at once to be reported as cancelled. It returns false when no jobs are left.
+func (s *scheduler) next() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.left > 0 {
+		best := ""
+		for _, key := range s.servers {
+			indexes := s.pending[key]
+			if len(indexes) == 0 {
+				continue
+			}
+			limit := s.jobs[indexes[0]].Server.MaxConcurrency
+			if !s.cancelled && limit > 0 && s.inFlight[key] >= limit {
+				continue
+			}
+			if best == "" || indexes[0] < s.pending[best][0] {
+				best = key
+			}
+		}
+		if best != "" {
+			i := s.pending[best][0]
+			s.pending[best] = s.pending[best][1:]
+			s.inFlight[best]++
+			s.left--
+			return i, true
+		}
+		s.cond.Wait()
+	}
+	return 0, false
+}
+
+// done releases the server slot of a finished job.
+func (s *scheduler) done(i int) {
+	s.mu.Lock()
+	s.inFlight[serverKey(s.jobs[i].Server)]--
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// cancel lifts the per-server limits and wakes waiting workers to drain the remaining jobs.
+func (s *scheduler) cancel() {
+	s.mu.Lock()
+	s.cancelled = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// serverKey identifies a server for per-server limits.
+func serverKey(server types.Server) string {
+	return server.Name + "|" + server.Address
+}
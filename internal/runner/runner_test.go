@@ -0,0 +1,157 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dnstester/internal/dns"
+	"dnstester/pkg/types"
+
+	mdns "github.com/miekg/dns"
+)
+
+// fakeProtocols numbers the protocol names fake transports are registered under, as the registry
+// does not allow registering a name twice.
+var fakeProtocols atomic.Int64
+
+// fakeTransport answers every query with an A record after a delay chosen per domain, and records
+// how many queries each server has in flight.
+type fakeTransport struct {
+	delay func(domain string) time.Duration
+	// started, if set, receives the domain of each query as it is sent
+	started chan string
+
+	mu          sync.Mutex
+	inFlight    map[string]int
+	maxInFlight map[string]int
+}
+
+// newFakeTransport registers a fake transport and returns it with its protocol name.
+func newFakeTransport(delay func(domain string) time.Duration) (*fakeTransport, string) {
+	t := &fakeTransport{delay: delay, inFlight: make(map[string]int), maxInFlight: make(map[string]int)}
+	protocol := fmt.Sprintf("fake%d", fakeProtocols.Add(1))
+	dns.Register(protocol, t)
+	return t, protocol
+}
+
+func (t *fakeTransport) Exchange(ctx context.Context, server types.Server, msg *mdns.Msg) (*mdns.Msg, error) {
+	domain := strings.TrimSuffix(msg.Question[0].Name, ".")
+	t.mu.Lock()
+	t.inFlight[server.Name]++
+	t.maxInFlight[server.Name] = max(t.maxInFlight[server.Name], t.inFlight[server.Name])
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.inFlight[server.Name]--
+		t.mu.Unlock()
+	}()
+	if t.started != nil {
+		t.started <- domain
+	}
+
+	select {
+	case <-time.After(t.delay(domain)):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	r := new(mdns.Msg)
+	r.SetReply(msg)
+	rr, _ := mdns.NewRR(msg.Question[0].Name + " 60 IN A 192.0.2.1")
+	r.Answer = append(r.Answer, rr)
+	return r, nil
+}
+
+// testJobs returns n jobs for server, querying d0 to d<n-1>.
+func testJobs(server types.Server, protocol string, n int) []Job {
+	jobs := make([]Job, n)
+	for i := range jobs {
+		jobs[i] = Job{Server: server, Domain: types.Domain{Name: fmt.Sprintf("d%d", i)}, Protocol: protocol, QueryType: "A"}
+	}
+	return jobs
+}
+
+func TestRunKeepsJobOrder(t *testing.T) {
+	// Later jobs answer sooner, so completion order is the reverse of job order
+	_, protocol := newFakeTransport(func(domain string) time.Duration {
+		var i int
+		fmt.Sscanf(domain, "d%d", &i)
+		return time.Duration(10-i) * 3 * time.Millisecond
+	})
+	jobs := testJobs(types.Server{Name: "a", Address: "192.0.2.1"}, protocol, 10)
+
+	var completed []string
+	results := Run(context.Background(), jobs, Options{
+		Concurrency: len(jobs),
+		OnResult: func(_ Job, result types.QueryResult) {
+			completed = append(completed, result.Domain)
+		},
+	})
+
+	if completed[0] == jobs[0].Domain.Name {
+		t.Fatalf("jobs completed in job order %v, the test needs them out of order", completed)
+	}
+	if len(results) != len(jobs) {
+		t.Fatalf("%d results for %d jobs", len(results), len(jobs))
+	}
+	for i, result := range results {
+		if result.Domain != jobs[i].Domain.Name || !result.Success {
+			t.Errorf("result %d is for %s (success %v, error %q), want a successful %s", i, result.Domain, result.Success, result.Error, jobs[i].Domain.Name)
+		}
+	}
+}
+
+func TestRunLimitsServerConcurrency(t *testing.T) {
+	transport, protocol := newFakeTransport(func(string) time.Duration { return 5 * time.Millisecond })
+	limited := types.Server{Name: "limited", Address: "192.0.2.1", MaxConcurrency: 2}
+	unlimited := types.Server{Name: "unlimited", Address: "192.0.2.2"}
+	jobs := append(testJobs(limited, protocol, 12), testJobs(unlimited, protocol, 12)...)
+
+	results := Run(context.Background(), jobs, Options{Concurrency: 8})
+
+	for i, result := range results {
+		if !result.Success {
+			t.Errorf("result %d failed: %s", i, result.Error)
+		}
+	}
+	if got := transport.maxInFlight["limited"]; got != 2 {
+		t.Errorf("limited server had %d queries in flight at most, want 2", got)
+	}
+	if got := transport.maxInFlight["unlimited"]; got <= 2 {
+		t.Errorf("unlimited server had %d queries in flight at most, want more than 2", got)
+	}
+}
+
+func TestRunCancelDrainsJobs(t *testing.T) {
+	transport, protocol := newFakeTransport(func(string) time.Duration { return time.Hour })
+	transport.started = make(chan string, 1)
+	jobs := testJobs(types.Server{Name: "slow", Address: "192.0.2.1", MaxConcurrency: 1}, protocol, 5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-transport.started
+		cancel()
+	}()
+
+	done := make(chan []types.QueryResult)
+	go func() { done <- Run(ctx, jobs, Options{Concurrency: 4}) }()
+	var results []types.QueryResult
+	select {
+	case results = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+
+	if len(results) != len(jobs) {
+		t.Fatalf("%d results for %d jobs", len(results), len(jobs))
+	}
+	for i, result := range results {
+		if result.Domain != jobs[i].Domain.Name || result.Success || !strings.Contains(result.Error, context.Canceled.Error()) {
+			t.Errorf("result %d is for %s (success %v, error %q), want %s cancelled", i, result.Domain, result.Success, result.Error, jobs[i].Domain.Name)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dnstester/internal/history"
+	"dnstester/internal/report"
+	"dnstester/pkg/types"
+)
+
+// saveRun stores a finished run in the history, if enabled. Failures are logged: the run's results
+// have already been returned to the client.
+func saveRun(store *history.Store, id, state string, started time.Time, req TestRequest, result types.Report) {
+	if store == nil {
+		return
+	}
+	request, err := json.Marshal(req)
+	if err != nil {
+		log.Printf("Error saving run %s: %v", id, err)
+		return
+	}
+	run := history.Run{
+		RunInfo: history.RunInfo{
+			ID:       id,
+			State:    state,
+			Started:  started,
+			Finished: time.Now(),
+		},
+		Request: request,
+		Report:  result,
+	}
+	if err := store.Save(run); err != nil {
+		log.Printf("Error saving run %s: %v", id, err)
+	}
+}
+
+// handleListReports handles GET /api/report, listing stored runs newest first. Query parameters since and
+// until (RFC 3339 times or YYYY-MM-DD dates), server, domain and limit filter the list.
+func handleListReports(store *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, "History is disabled", http.StatusNotFound)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := history.Filter{
+			Server: query.Get("server"),
+			Domain: query.Get("domain"),
+		}
+		var err error
+		if filter.Since, err = parseTime(query.Get("since"), false); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid since: %v", err), http.StatusBadRequest)
+			return
+		}
+		if filter.Until, err = parseTime(query.Get("until"), true); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid until: %v", err), http.StatusBadRequest)
+			return
+		}
+		if limit := query.Get("limit"); limit != "" {
+			if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		writeJSON(w, http.StatusOK, store.List(filter))
+	}
+}
+
+// handleGetReport handles GET /api/report/{id}. Without a format parameter it returns the stored run
+// (request, report and metadata) as JSON; with format=csv, json or another report format it returns the
+// run's report in that format as a download.
+func handleGetReport(store *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			http.Error(w, "History is disabled", http.StatusNotFound)
+			return
+		}
+		run, err := store.Get(r.PathValue("id"))
+		if errors.Is(err, history.ErrNotFound) {
+			http.Error(w, "Run not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			writeJSON(w, http.StatusOK, run)
+			return
+		}
+		if err := report.ValidateFormat(format); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		contentType, extension := "text/plain; charset=utf-8", "txt"
+		switch format {
+		case report.FormatCSV:
+			contentType, extension = "text/csv; charset=utf-8", "csv"
+		case report.FormatJSON:
+			contentType, extension = "application/json", "json"
+		case report.FormatNDJSON:
+			contentType, extension = "application/x-ndjson", "ndjson"
+		case report.FormatJUnit:
+			contentType, extension = "application/xml", "xml"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dnstester-%s.%s"`, run.ID, extension))
+		if err := report.WriteReport(w, &run.Report, format); err != nil {
+			log.Printf("Error writing report %s: %v", run.ID, err)
+		}
+	}
+}
+
+// parseTime parses an RFC 3339 time or a YYYY-MM-DD date; a date used as an upper bound covers the
+// whole day. An empty value is the zero time.
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("'%s' is not an RFC 3339 time or YYYY-MM-DD date", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
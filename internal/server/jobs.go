@@ -0,0 +1,336 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"dnstester/internal/history"
+	"dnstester/internal/report"
+	"dnstester/internal/runner"
+	"dnstester/pkg/types"
+)
+
+// Job states
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobCancelled = "cancelled"
+)
+
+// jobRetention is how long a finished job stays available to GET /api/jobs/{id}.
+const jobRetention = time.Hour
+
+// maxRunningJobs limits the jobs running at once, since each runs its own worker pool.
+const maxRunningJobs = 8
+
+// errTooManyJobs is returned by jobStore.start when maxRunningJobs are already running.
+var errTooManyJobs = errors.New("Too many running jobs, try again later")
+
+// JobStatus is the state of an asynchronous test job. Results are in completion order while the job
+// runs; once it has completed they are in the same order as /api/test results, and Summary and
+// Consistency are set. A cancelled job keeps the results that completed before it was cancelled.
+type JobStatus struct {
+	ID        string     `json:"id"`
+	State     string     `json:"state"`
+	Total     int        `json:"total"`     // number of queries in the job
+	Completed int        `json:"completed"` // number of results so far
+	Created   time.Time  `json:"created"`
+	Finished  *time.Time `json:"finished,omitempty"`
+
+	Results     []types.QueryResult      `json:"results"`
+	Summary     *types.Summary           `json:"summary,omitempty"`
+	Consistency []types.ConsistencyGroup `json:"consistency,omitempty"`
+}
+
+// job is a test run in the background. Every change closes and replaces updated, so any number of
+// event streams can follow the job without buffering results per stream.
+type job struct {
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	status    JobStatus
+	completed []types.QueryResult // in completion order; status.Results once the job has completed
+	updated   chan struct{}
+}
+
+// jobStore holds the running and recently finished jobs.
+type jobStore struct {
+	history *history.Store // finished jobs are saved here, if set
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	running int
+}
+
+// newJobStore creates an empty job store.
+func newJobStore(store *history.Store) *jobStore {
+	return &jobStore{history: store, jobs: make(map[string]*job)}
+}
+
+// start plans the request's tests and runs them in the background as a new job. It returns
+// errTooManyJobs when maxRunningJobs are already running.
+func (s *jobStore) start(req TestRequest, cfg *types.Config) (*job, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	jobs := runner.Plan(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		cancel: cancel,
+		status: JobStatus{
+			ID:      id,
+			State:   JobRunning,
+			Total:   len(jobs),
+			Created: time.Now(),
+			Results: []types.QueryResult{},
+		},
+		completed: []types.QueryResult{},
+		updated:   make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	if s.running >= maxRunningJobs {
+		s.mu.Unlock()
+		cancel()
+		return nil, errTooManyJobs
+	}
+	s.running++
+	s.jobs[id] = j
+	s.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		results := runner.Run(ctx, jobs, runner.Options{
+			OnResult: func(_ runner.Job, result types.QueryResult) {
+				// Queries aborted by a cancel are not part of the job's results
+				if ctx.Err() == nil {
+					j.update(func(status *JobStatus) {
+						j.completed = append(j.completed, result)
+						status.Completed++
+					})
+				}
+			},
+		})
+
+		j.update(func(status *JobStatus) {
+			// A cancel that arrives after the last query finished does not cancel the job
+			if len(j.completed) == len(jobs) {
+				status.State = JobCompleted
+				status.Results = results
+			} else {
+				status.State = JobCancelled
+				status.Results = j.completed
+			}
+			summary := report.CalculateSummary(status.Results)
+			status.Summary = &summary
+			status.Consistency = report.AnalyzeConsistency(status.Results, req.Reference)
+			finished := time.Now()
+			status.Finished = &finished
+		})
+
+		status, _ := j.snapshot()
+		saveRun(s.history, status.ID, status.State, status.Created, req, types.Report{
+			Results:     status.Results,
+			Summary:     *status.Summary,
+			Consistency: status.Consistency,
+		})
+
+		s.mu.Lock()
+		s.running--
+		s.mu.Unlock()
+
+		time.AfterFunc(jobRetention, func() {
+			s.mu.Lock()
+			delete(s.jobs, id)
+			s.mu.Unlock()
+		})
+	}()
+	return j, nil
+}
+
+// get returns the job with the given ID, or nil.
+func (s *jobStore) get(id string) *job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+// update applies change to the job status and wakes up everyone waiting for a change.
+func (j *job) update(change func(status *JobStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	change(&j.status)
+	close(j.updated)
+	j.updated = make(chan struct{})
+}
+
+// snapshot returns a copy of the job status and a channel that is closed on its next change.
+func (j *job) snapshot() (JobStatus, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := j.status
+	if status.State == JobRunning {
+		status.Results = append([]types.QueryResult{}, j.completed...)
+	}
+	return status, j.updated
+}
+
+// since returns the results completed after the first n, the job state and a channel that is closed
+// on the job's next change.
+func (j *job) since(n int) ([]types.QueryResult, string, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	n = min(n, len(j.completed))
+	return append([]types.QueryResult(nil), j.completed[n:]...), j.status.State, j.updated
+}
+
+// newID returns a random job or run ID.
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// handleCreateJob handles POST /api/jobs. Accepts the same JSON as /api/test, starts the tests in the
+// background and responds with 202 Accepted and the job status; its ID is also in the Location header.
+func (s *jobStore) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	var req TestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	cfg, err := req.config()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	j, err := s.start(req, cfg)
+	if errors.Is(err, errTooManyJobs) {
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	status, _ := j.snapshot()
+	w.Header().Set("Location", "/api/jobs/"+status.ID)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// handleGetJob handles GET /api/jobs/{id}, returning the job status with the results so far.
+func (s *jobStore) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	j := s.get(r.PathValue("id"))
+	if j == nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	status, _ := j.snapshot()
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleCancelJob handles DELETE /api/jobs/{id}. Cancels a running job, keeping the results that have
+// already completed, and returns its status; a finished job, or one whose queries have all finished,
+// is left to complete.
+func (s *jobStore) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	j := s.get(r.PathValue("id"))
+	if j == nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	j.cancel()
+	status, updated := j.snapshot()
+	for status.State == JobRunning {
+		<-updated
+		status, updated = j.snapshot()
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleJobEvents handles GET /api/jobs/{id}/events, streaming the job as Server-Sent Events: a
+// "result" event with each QueryResult (starting with those already completed) and a final "done"
+// event with the job status once it has completed or been cancelled. Result events carry their index
+// in completion order as the event ID, so a client reconnecting with Last-Event-ID resumes after the
+// last result it received.
+func (s *jobStore) handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	j := s.get(r.PathValue("id"))
+	if j == nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sent := 0
+	if last, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil && last >= 0 {
+		sent = last + 1
+	}
+	for {
+		results, state, updated := j.since(sent)
+		for i, result := range results {
+			if err := writeEvent(w, strconv.Itoa(sent+i), "result", result); err != nil {
+				return
+			}
+		}
+		sent += len(results)
+		if state != JobRunning {
+			status, _ := j.snapshot()
+			writeEvent(w, "", "done", status)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-updated:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes one Server-Sent Event with a JSON payload, and an event ID unless id is empty.
+func writeEvent(w http.ResponseWriter, id string, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
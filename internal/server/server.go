@@ -1,28 +1,86 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"time"
 
-	"dnstester/internal/dns"
+	"dnstester/internal/config"
+	"dnstester/internal/history"
+	"dnstester/internal/metrics"
+	"dnstester/internal/monitor"
 	"dnstester/internal/report"
+	"dnstester/internal/runner"
 	"dnstester/pkg/types"
 )
 
-// StartServer starts an HTTP server using net/http. Registers handlers for WebUI (/) and API endpoints.
-// Blocks until the server stops or encounters an error.
-func StartServer(addr string) error {
+// Options configures optional server features.
+type Options struct {
+	// Monitor, if set, is a configuration (with defaults applied) whose tests run on the monitor
+	// schedule while the server is up; their results are exposed on /metrics.
+	Monitor *types.Config
+	// Concurrency is the maximum number of scheduled queries in flight per server run.
+	Concurrency int
+	// History, if set, stores every run started from the WebUI or API and serves them on /api/report.
+	History *history.Store
+}
+
+// StartServer starts an HTTP server using net/http. Registers handlers for WebUI (/) and API endpoints,
+// and /metrics when scheduled checks are configured. Blocks until the server stops or encounters an error.
+func StartServer(addr string, opts Options) error {
 	http.HandleFunc("/", handleIndex)
-	http.HandleFunc("/api/test", handleTest)
-	http.HandleFunc("/api/report", handleReport)
+	http.HandleFunc("/api/test", handleTest(opts.History))
+	http.HandleFunc("GET /api/report", handleListReports(opts.History))
+	http.HandleFunc("GET /api/report/{id}", handleGetReport(opts.History))
+
+	jobs := newJobStore(opts.History)
+	http.HandleFunc("POST /api/jobs", jobs.handleCreateJob)
+	http.HandleFunc("GET /api/jobs/{id}", jobs.handleGetJob)
+	http.HandleFunc("DELETE /api/jobs/{id}", jobs.handleCancelJob)
+	http.HandleFunc("GET /api/jobs/{id}/events", jobs.handleJobEvents)
+
+	if opts.Monitor != nil {
+		collector := metrics.NewCollector()
+		m := monitor.New(opts.Monitor, monitor.Options{
+			Concurrency: opts.Concurrency,
+			OnResult:    collector.Observe,
+			OnEvent: func(event types.MonitorEvent) {
+				line := fmt.Sprintf("%s: %s %s via %s: %s → %s", event.ServerName, event.Domain, event.QueryType,
+					event.Protocol, event.From, event.To)
+				if event.Error != "" {
+					line += " (" + event.Error + ")"
+				}
+				log.Print(line)
+			},
+		})
+		http.HandleFunc("/metrics", handleMetrics(collector, m))
+		go m.Run(context.Background())
+		log.Printf("Running scheduled checks for %d server(s); metrics at /metrics", len(opts.Monitor.Servers))
+	}
 
 	log.Printf("Server listening on http://localhost%s", addr)
 	return http.ListenAndServe(addr, nil)
 }
 
+// handleMetrics serves the results of scheduled checks and the monitor state of their targets in the
+// Prometheus text exposition format.
+func handleMetrics(collector *metrics.Collector, m *monitor.Monitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := collector.Write(w, m.Snapshot()); err != nil {
+			log.Printf("Error writing metrics: %v", err)
+		}
+	}
+}
+
 // handleIndex serves the WebUI HTML page. Uses html/template to parse and serve embedded HTML/CSS/JS.
 // Only accepts GET requests.
 func handleIndex(w http.ResponseWriter, r *http.Request) {
@@ -81,7 +139,7 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             color: #666;
             font-weight: 500;
         }
-        input[type="text"], textarea {
+        input[type="text"], textarea, select {
             width: 100%;
             padding: 10px;
             border: 2px solid #ddd;
@@ -89,7 +147,7 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             font-size: 14px;
             transition: border-color 0.3s;
         }
-        input[type="text"]:focus, textarea:focus {
+        input[type="text"]:focus, textarea:focus, select:focus {
             outline: none;
             border-color: #667eea;
         }
@@ -195,6 +253,16 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
         #results.active {
             display: block;
         }
+        #history {
+            margin-top: 30px;
+            display: none;
+        }
+        .history-filters {
+            display: grid;
+            grid-template-columns: repeat(auto-fit, minmax(180px, 1fr));
+            gap: 15px;
+            align-items: end;
+        }
         .summary {
             background: #f8f9fa;
             padding: 20px;
@@ -237,6 +305,36 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
         .results-table tr:hover {
             background: #f8f9fa;
         }
+        .results-table tr.expandable {
+            cursor: pointer;
+        }
+        .results-table tr.details,
+        .results-table tr.details:hover {
+            background: #f8f9fa;
+        }
+        .expander {
+            color: #667eea;
+        }
+        .details-grid {
+            display: flex;
+            flex-wrap: wrap;
+            gap: 8px 24px;
+            margin-bottom: 10px;
+        }
+        .details-label {
+            color: #666;
+            font-size: 12px;
+            text-transform: uppercase;
+        }
+        .results-table table.records {
+            border-collapse: collapse;
+            margin: 4px 0 10px;
+            font-family: monospace;
+        }
+        .results-table table.records td {
+            padding: 2px 16px 2px 0;
+            border-bottom: none;
+        }
         .status-success {
             color: #28a745;
             font-weight: 600;
@@ -266,6 +364,39 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
                     <label for="domains">Enter domains (one per line):</label>
                     <textarea id="domains" name="domains" placeholder="github.com&#10;google.com&#10;cloudflare.com" required></textarea>
                 </div>
+                <div class="input-group">
+                    <label for="queryTypes">Query types (comma-separated):</label>
+                    <input type="text" id="queryTypes" name="queryTypes" value="A" placeholder="e.g., A, AAAA, MX, TXT">
+                </div>
+                <div class="input-group">
+                    <label for="timeout">Timeout per attempt:</label>
+                    <input type="text" id="timeout" name="timeout" value="10s" placeholder="e.g., 2s, 500ms">
+                </div>
+                <div class="input-group">
+                    <label for="retries">Retries after a transport error:</label>
+                    <input type="text" id="retries" name="retries" value="0" placeholder="e.g., 2">
+                </div>
+                <div class="input-group">
+                    <label for="reference">Reference server for answer comparison (optional):</label>
+                    <input type="text" id="reference" name="reference" placeholder="Server name; default compares against the majority">
+                </div>
+                <div class="input-group">
+                    <label>DNSSEC:</label>
+                    <div class="protocols">
+                        <div class="protocol-checkbox">
+                            <input type="checkbox" id="dnssec-do">
+                            <label for="dnssec-do">Set DO bit</label>
+                        </div>
+                        <div class="protocol-checkbox">
+                            <input type="checkbox" id="dnssec-cd">
+                            <label for="dnssec-cd">Set CD bit</label>
+                        </div>
+                        <div class="protocol-checkbox">
+                            <input type="checkbox" id="dnssec-validate">
+                            <label for="dnssec-validate">Validate locally (root trust anchor)</label>
+                        </div>
+                    </div>
+                </div>
             </div>
 
             <div class="form-section">
@@ -301,6 +432,14 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
                                 <input type="checkbox" name="protocol" value="doh" id="protocol-doh-0">
                                 <label for="protocol-doh-0">DoH</label>
                             </div>
+                            <div class="protocol-checkbox">
+                                <input type="checkbox" name="protocol" value="doq" id="protocol-doq-0">
+                                <label for="protocol-doq-0">DoQ</label>
+                            </div>
+                        </div>
+                        <div class="protocol-checkbox">
+                            <input type="checkbox" name="identify" id="identify-0">
+                            <label for="identify-0">Identify anycast instance</label>
                         </div>
                     </div>
                 </div>
@@ -309,11 +448,12 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 
             <div class="loading" id="loading">
                 <div class="spinner"></div>
-                <p>Running DNS tests... This may take a moment.</p>
+                <p id="progressText">Running DNS tests... This may take a moment.</p>
             </div>
 
             <div style="margin-top: 20px;">
                 <button type="submit" class="btn" id="submitBtn">Run Tests</button>
+                <button type="button" class="btn btn-secondary" id="cancelBtn" onclick="cancelJob()" style="display: none;">Cancel</button>
                 <button type="button" class="btn btn-secondary" onclick="resetForm()">Reset</button>
             </div>
         </form>
@@ -321,7 +461,45 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
         <div id="results">
             <h2 style="margin-top: 30px; margin-bottom: 20px;">Test Results</h2>
             <div id="summary" class="summary"></div>
+            <div class="input-group">
+                <label for="breakdownDimension">Breakdown by:</label>
+                <select id="breakdownDimension" onchange="displayBreakdown()">
+                    <option value="by_server">Server</option>
+                    <option value="by_protocol">Protocol</option>
+                    <option value="by_server_protocol" selected>Server × Protocol</option>
+                    <option value="by_domain">Domain</option>
+                    <option value="by_instance">Instance</option>
+                </select>
+            </div>
+            <div id="breakdownTable"></div>
             <div id="resultsTable"></div>
+            <div id="consistencyTable"></div>
+        </div>
+
+        <div id="history" class="form-section">
+            <h2>History</h2>
+            <div class="history-filters">
+                <div class="input-group">
+                    <label for="historyServer">Server:</label>
+                    <input type="text" id="historyServer" placeholder="Any server">
+                </div>
+                <div class="input-group">
+                    <label for="historyDomain">Domain:</label>
+                    <input type="text" id="historyDomain" placeholder="Any domain">
+                </div>
+                <div class="input-group">
+                    <label for="historySince">From:</label>
+                    <input type="date" id="historySince">
+                </div>
+                <div class="input-group">
+                    <label for="historyUntil">To:</label>
+                    <input type="date" id="historyUntil">
+                </div>
+                <div class="input-group">
+                    <button type="button" class="btn btn-secondary" onclick="loadHistory()">Search</button>
+                </div>
+            </div>
+            <div id="historyTable"></div>
         </div>
     </div>
 
@@ -379,6 +557,14 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
                         '<input type="checkbox" name="protocol" value="doh" id="protocol-doh-' + uniqueId + '">' +
                         '<label for="protocol-doh-' + uniqueId + '">DoH</label>' +
                     '</div>' +
+                    '<div class="protocol-checkbox">' +
+                        '<input type="checkbox" name="protocol" value="doq" id="protocol-doq-' + uniqueId + '">' +
+                        '<label for="protocol-doq-' + uniqueId + '">DoQ</label>' +
+                    '</div>' +
+                '</div>' +
+                '<div class="protocol-checkbox">' +
+                    '<input type="checkbox" name="identify" id="identify-' + uniqueId + '">' +
+                    '<label for="identify-' + uniqueId + '">Identify anycast instance</label>' +
                 '</div>';
             serversDiv.appendChild(newServer);
         }
@@ -422,6 +608,11 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
                 .map(d => d.trim())
                 .filter(d => d.length > 0);
 
+            // Collect query types
+            const queryTypes = document.getElementById('queryTypes').value.split(',')
+                .map(t => t.trim().toUpperCase())
+                .filter(t => t.length > 0);
+
             // Collect servers
             const serverItems = document.querySelectorAll('.server-item');
             const servers = [];
@@ -436,7 +627,8 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
                     servers.push({
                         name: name,
                         address: address,
-                        protocols: protocols
+                        protocols: protocols,
+                        identify: item.querySelector('input[name="identify"]').checked
                     });
                 }
             });
@@ -456,38 +648,112 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             }
 
             try {
-                const response = await fetch('/api/test', {
+                const response = await fetch('/api/jobs', {
                     method: 'POST',
                     headers: {
                         'Content-Type': 'application/json',
                     },
                     body: JSON.stringify({
                         domains: domains,
-                        servers: servers
+                        query_types: queryTypes,
+                        servers: servers,
+                        timeout: document.getElementById('timeout').value.trim() || '10s',
+                        retries: parseInt(document.getElementById('retries').value, 10) || 0,
+                        reference: document.getElementById('reference').value.trim(),
+                        dnssec: {
+                            do: document.getElementById('dnssec-do').checked,
+                            cd: document.getElementById('dnssec-cd').checked,
+                            validate: document.getElementById('dnssec-validate').checked
+                        }
                     })
                 });
 
                 if (!response.ok) {
-                    throw new Error('Test failed: ' + response.statusText);
+                    throw new Error('Test failed: ' + (await response.text() || response.statusText));
                 }
 
-                const data = await response.json();
-                displayResults(data);
+                followJob(await response.json());
             } catch (error) {
                 alert('Error running tests: ' + error.message);
-            } finally {
-                loading.classList.remove('active');
-                submitBtn.disabled = false;
+                finishJob();
             }
         });
 
+        let currentJob = null;
+
+        // followJob fills the results table as the job's results arrive and shows the full report
+        // once the job has completed or been cancelled.
+        function followJob(job) {
+            currentJob = { id: job.id, total: job.total, events: new EventSource('/api/jobs/' + job.id + '/events') };
+            let completed = 0;
+            updateProgress(completed, job.total);
+            document.getElementById('cancelBtn').style.display = 'inline-block';
+
+            const results = document.getElementById('results');
+            document.getElementById('summary').innerHTML = '';
+            document.getElementById('breakdownTable').innerHTML = '';
+            document.getElementById('consistencyTable').innerHTML = '';
+            document.getElementById('resultsTable').innerHTML =
+                '<table class="results-table">' + resultsTableHeader() + '<tbody id="resultsBody"></tbody></table>';
+            results.classList.add('active');
+            results.style.display = 'block';
+
+            currentJob.events.addEventListener('result', (e) => {
+                document.getElementById('resultsBody').insertAdjacentHTML('beforeend', resultRow(JSON.parse(e.data)));
+                updateProgress(++completed, job.total);
+            });
+            currentJob.events.addEventListener('done', (e) => {
+                const status = JSON.parse(e.data);
+                finishJob();
+                displayResults(status);
+                loadHistory();
+                if (status.state === 'cancelled') {
+                    document.getElementById('summary').insertAdjacentHTML('afterbegin',
+                        '<div class="summary-item"><div class="summary-label">Cancelled</div>' +
+                        '<div class="summary-value">' + status.completed + ' / ' + status.total + '</div></div>');
+                }
+            });
+            currentJob.events.onerror = () => {
+                // EventSource reconnects by itself; give up only if the server has forgotten the job
+                fetch('/api/jobs/' + job.id).then(response => {
+                    if (response.status === 404) {
+                        finishJob();
+                        alert('Error running tests: the job is no longer available');
+                    }
+                });
+            };
+        }
+
+        async function cancelJob() {
+            if (!currentJob) {
+                return;
+            }
+            document.getElementById('progressText').textContent = 'Cancelling...';
+            await fetch('/api/jobs/' + currentJob.id, { method: 'DELETE' });
+        }
+
+        function finishJob() {
+            if (currentJob) {
+                currentJob.events.close();
+                currentJob = null;
+            }
+            document.getElementById('loading').classList.remove('active');
+            document.getElementById('submitBtn').disabled = false;
+            document.getElementById('cancelBtn').style.display = 'none';
+        }
+
+        function updateProgress(completed, total) {
+            document.getElementById('progressText').textContent =
+                'Running DNS tests... ' + completed + ' of ' + total + ' queries completed';
+        }
+
         function displayResults(data) {
             const results = document.getElementById('results');
             const summary = document.getElementById('summary');
             const resultsTable = document.getElementById('resultsTable');
 
             // Display summary
-            const avgTime = data.summary.average_time ? data.summary.average_time.toFixed(2) : '0.00';
+            const avgTime = (data.summary.average_time || 0).toFixed(3);
             summary.innerHTML = 
                 '<div class="summary-item">' +
                     '<div class="summary-label">Total Queries</div>' +
@@ -501,51 +767,315 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
                     '<div class="summary-label">Failed</div>' +
                     '<div class="summary-value" style="color: #dc3545;">' + data.summary.failed + '</div>' +
                 '</div>' +
+                '<div class="summary-item">' +
+                    '<div class="summary-label">After Retry</div>' +
+                    '<div class="summary-value">' + (data.summary.retried || 0) + '</div>' +
+                '</div>' +
+                (data.summary.assertions_passed + data.summary.assertions_failed > 0 ?
+                    '<div class="summary-item">' +
+                        '<div class="summary-label">Assertions</div>' +
+                        '<div class="summary-value"><span style="color: #28a745;">' + data.summary.assertions_passed +
+                        '</span> / <span style="color: #dc3545;">' + data.summary.assertions_failed + '</span></div>' +
+                    '</div>' : '') +
                 '<div class="summary-item">' +
                     '<div class="summary-label">Avg Time</div>' +
                     '<div class="summary-value">' + avgTime + ' ms</div>' +
                 '</div>' +
                 '<div class="summary-item">' +
                     '<div class="summary-label">Min Time</div>' +
-                    '<div class="summary-value">' + (data.summary.min_time || 0) + ' ms</div>' +
+                    '<div class="summary-value">' + (data.summary.min_time || 0).toFixed(3) + ' ms</div>' +
                 '</div>' +
                 '<div class="summary-item">' +
                     '<div class="summary-label">Max Time</div>' +
-                    '<div class="summary-value">' + (data.summary.max_time || 0) + ' ms</div>' +
+                    '<div class="summary-value">' + (data.summary.max_time || 0).toFixed(3) + ' ms</div>' +
+                '</div>' +
+                '<div class="summary-item">' +
+                    '<div class="summary-label">P50 / P95 / P99</div>' +
+                    '<div class="summary-value">' + (data.summary.p50_time || 0).toFixed(1) + ' / ' +
+                        (data.summary.p95_time || 0).toFixed(1) + ' / ' + (data.summary.p99_time || 0).toFixed(1) + ' ms</div>' +
+                '</div>' +
+                '<div class="summary-item">' +
+                    '<div class="summary-label">Std Deviation</div>' +
+                    '<div class="summary-value">' + (data.summary.stddev_time || 0).toFixed(2) + ' ms</div>' +
                 '</div>';
 
+            currentSummary = data.summary;
+            displayBreakdown();
+
             // Display results table
-            let tableHTML = '<table class="results-table"><thead><tr><th>Server</th><th>Address</th><th>Domain</th><th>Protocol</th><th>Response IPs</th><th>Time (ms)</th><th>Status</th><th>Error</th></tr></thead><tbody>';
-            
-            data.results.forEach(result => {
-                const status = result.success ? 
-                    '<span class="status-success">✓ Success</span>' : 
-                    '<span class="status-failed">✗ Failed</span>';
-                const ips = result.response_ips && result.response_ips.length > 0 ? 
-                    result.response_ips.join(', ') : 'N/A';
-                const error = result.error || '-';
-                
-                tableHTML += 
-                    '<tr>' +
-                        '<td>' + escapeHtml(result.server_name) + '</td>' +
-                        '<td>' + escapeHtml(result.server_address) + '</td>' +
-                        '<td>' + escapeHtml(result.domain) + '</td>' +
-                        '<td>' + escapeHtml(result.protocol.toUpperCase()) + '</td>' +
-                        '<td>' + escapeHtml(ips) + '</td>' +
-                        '<td>' + result.response_time + '</td>' +
-                        '<td>' + status + '</td>' +
-                        '<td>' + escapeHtml(error) + '</td>' +
-                    '</tr>';
-            });
-            
-            tableHTML += '</tbody></table>';
-            resultsTable.innerHTML = tableHTML;
+            resultsTable.innerHTML = '<table class="results-table">' + resultsTableHeader() + '<tbody>' +
+                data.results.map(resultRow).join('') + '</tbody></table>';
+
+            displayConsistency(data.consistency || []);
 
             results.classList.add('active');
             results.style.display = 'block';
             results.scrollIntoView({ behavior: 'smooth' });
         }
 
+        function resultsTableHeader() {
+            return '<thead><tr><th>Server</th><th>Address</th><th>Domain</th><th>Type</th><th>Protocol</th><th>Answers</th><th>Time (ms)</th><th>DNSSEC</th><th>Status</th><th>Assertion</th><th>Error</th></tr></thead>';
+        }
+
+        function resultRow(result) {
+            let status = result.success ?
+                '<span class="status-success">✓ Success</span>' :
+                '<span class="status-failed">✗ Failed</span>';
+            if (result.success && result.attempts > 1) {
+                status = '<span class="status-success">✓ Success after ' + result.attempts + ' attempts</span>';
+            }
+            const answers = result.answers && result.answers.length > 0 ?
+                result.answers.map(formatAnswer).join(', ') : 'N/A';
+            let error = result.error ||
+                (result.attempts > 1 ? 'earlier attempts: ' + result.attempt_errors.join('; ') : '-');
+            (result.extended_errors || []).forEach(ede => {
+                error = (error === '-' ? '' : error + '; ') + formatExtendedError(ede);
+            });
+            if (result.dnssec_reason) {
+                error = (error === '-' ? '' : error + '; ') + 'dnssec: ' + result.dnssec_reason;
+            }
+            if (result.cookie_status && result.cookie_status !== 'valid') {
+                error = (error === '-' ? '' : error + '; ') + 'cookie: ' + result.cookie_status;
+            }
+            if (result.padding_status === 'unpadded') {
+                error = (error === '-' ? '' : error + '; ') + 'padding: response not padded';
+            }
+            let assertion = '-';
+            if (result.assertion) {
+                assertion = result.assertion.passed ?
+                    '<span class="status-success">✓ Passed</span>' :
+                    '<span class="status-failed">✗ ' + escapeHtml(result.assertion.failures.join('; ')) + '</span>';
+            }
+            let dnssec = result.dnssec_status || (result.flags.ad ? 'AD' : '-');
+            if (result.dnssec_status && result.flags.ad) {
+                dnssec += ' (AD)';
+            }
+            const protocol = result.http_version ?
+                result.protocol.toUpperCase() + ' (' + result.http_version + ')' : result.protocol.toUpperCase();
+            const time = result.response_time.toFixed(3) + formatTiming(result.timing);
+
+            return '<tr class="expandable" onclick="toggleDetails(this)" title="Show response details">' +
+                    '<td><span class="expander">▸</span> ' + escapeHtml(result.server_name) + '</td>' +
+                    '<td>' + escapeHtml(result.server_address) + '</td>' +
+                    '<td>' + escapeHtml(result.domain) + '</td>' +
+                    '<td>' + escapeHtml(result.query_type) + '</td>' +
+                    '<td>' + escapeHtml(protocol) + '</td>' +
+                    '<td>' + escapeHtml(answers) + '</td>' +
+                    '<td>' + time + '</td>' +
+                    '<td>' + escapeHtml(dnssec) + '</td>' +
+                    '<td>' + status + '</td>' +
+                    '<td>' + assertion + '</td>' +
+                    '<td>' + escapeHtml(error) + '</td>' +
+                '</tr>' +
+                '<tr class="details" style="display: none;"><td colspan="11">' + resultDetails(result) + '</td></tr>';
+        }
+
+        function toggleDetails(row) {
+            const details = row.nextElementSibling;
+            const open = details.style.display === 'none';
+            details.style.display = open ? 'table-row' : 'none';
+            row.querySelector('.expander').textContent = open ? '▾' : '▸';
+        }
+
+        // resultDetails renders the response metadata of a result: rcode, header flags, size, EDNS and
+        // its checks, and the records of every section. Results stored before these were recorded
+        // show what they have.
+        function resultDetails(result) {
+            const flags = result.flags ?
+                ['aa', 'tc', 'rd', 'ra', 'ad', 'cd'].filter(flag => result.flags[flag]).join(' ') : '';
+            const edns = result.edns ?
+                'version ' + result.edns.version + ', UDP size ' + result.edns.udp_size + (result.edns.do ? ', DO' : '') : '-';
+            const item = (label, value) =>
+                '<div><span class="details-label">' + label + '</span> ' + escapeHtml(String(value)) + '</div>';
+
+            let html = '<div class="details-grid">' +
+                item('Rcode', result.rcode || 'no response') +
+                item('Flags', flags || '-') +
+                item('Size', result.response_size ? result.response_size + ' bytes' : '-') +
+                item('EDNS', edns) +
+                (result.edns && result.edns.options && result.edns.options.length > 0 ?
+                    item('EDNS options', result.edns.options.map(option => option.name + ' ' + option.data).join(', ')) : '') +
+                (result.cookie_status ? item('Cookie', result.cookie_status) : '') +
+                (result.padding_status ? item('Padding', result.padding_status) : '') +
+                (result.instance_source ?
+                    item('Instance', result.instance ? result.instance + ' (' + result.instance_source + ')' : 'unidentified') : '') +
+                item('Attempts', result.attempts) +
+                '</div>';
+            [['Answer', result.answers], ['Authority', result.authority], ['Additional', result.additional]]
+                .forEach(([section, records]) => {
+                    if (!records || records.length === 0) {
+                        return;
+                    }
+                    html += '<div class="details-label">' + section + ' section</div><table class="records"><tbody>' +
+                        records.map(record => '<tr>' +
+                            '<td>' + escapeHtml(record.name || '') + '</td>' +
+                            '<td>' + record.ttl + '</td>' +
+                            '<td>' + escapeHtml(record.type) + '</td>' +
+                            '<td>' + escapeHtml(record.data) + '</td>' +
+                        '</tr>').join('') +
+                        '</tbody></table>';
+                });
+            return html;
+        }
+
+        async function loadHistory() {
+            const params = new URLSearchParams({ limit: '50' });
+            [['server', 'historyServer'], ['domain', 'historyDomain'], ['since', 'historySince'], ['until', 'historyUntil']]
+                .forEach(([param, id]) => {
+                    const value = document.getElementById(id).value.trim();
+                    if (value) {
+                        params.set(param, value);
+                    }
+                });
+
+            const response = await fetch('/api/report?' + params);
+            const history = document.getElementById('history');
+            if (response.status === 404) {
+                // History is disabled on this server
+                history.style.display = 'none';
+                return;
+            }
+            history.style.display = 'block';
+            if (!response.ok) {
+                document.getElementById('historyTable').textContent = await response.text();
+                return;
+            }
+            const runs = await response.json();
+
+            let html = '<table class="results-table"><thead><tr><th>Started</th><th>State</th><th>Servers</th><th>Domains</th>' +
+                '<th>Queries</th><th>Successful</th><th>Failed</th><th>Avg (ms)</th><th></th></tr></thead><tbody>';
+            runs.forEach(run => {
+                const download = (format, label) =>
+                    '<a href="/api/report/' + encodeURIComponent(run.id) + '?format=' + format + '" download>' + label + '</a>';
+                html += '<tr>' +
+                    '<td>' + escapeHtml(new Date(run.started).toLocaleString()) + '</td>' +
+                    '<td>' + escapeHtml(run.state) + '</td>' +
+                    '<td>' + escapeHtml(run.servers.join(', ')) + '</td>' +
+                    '<td>' + escapeHtml(run.domains.join(', ')) + '</td>' +
+                    '<td>' + run.total_queries + '</td>' +
+                    '<td>' + run.successful + '</td>' +
+                    '<td>' + run.failed + '</td>' +
+                    '<td>' + (run.average_time || 0).toFixed(3) + '</td>' +
+                    '<td><a href="#" onclick="viewRun(\'' + escapeHtml(run.id) + '\'); return false;">View</a> | ' +
+                        download('csv', 'CSV') + ' | ' + download('json', 'JSON') + '</td>' +
+                '</tr>';
+            });
+            if (runs.length === 0) {
+                html += '<tr><td colspan="9">No runs found</td></tr>';
+            }
+            html += '</tbody></table>';
+            document.getElementById('historyTable').innerHTML = html;
+        }
+
+        async function viewRun(id) {
+            try {
+                const response = await fetch('/api/report/' + encodeURIComponent(id));
+                if (!response.ok) {
+                    throw new Error(await response.text() || response.statusText);
+                }
+                const run = await response.json();
+                displayResults(run.report);
+            } catch (error) {
+                alert('Error loading run: ' + error.message);
+            }
+        }
+
+        loadHistory();
+
+        let currentSummary = null;
+
+        function displayBreakdown() {
+            const breakdownTable = document.getElementById('breakdownTable');
+            const dimension = document.getElementById('breakdownDimension').value;
+            const groups = (currentSummary && currentSummary[dimension]) || [];
+            const ms = (group, value) => group.successful > 0 ? value.toFixed(3) : '-';
+
+            let html = '<table class="results-table"><thead><tr><th>Group</th><th>Queries</th><th>Successful</th><th>Failed</th>' +
+                '<th>Avg (ms)</th><th>Min (ms)</th><th>Max (ms)</th><th>P50 (ms)</th><th>P90 (ms)</th><th>P95 (ms)</th><th>P99 (ms)</th><th>StdDev (ms)</th></tr></thead><tbody>';
+            groups.forEach(group => {
+                const instance = dimension === 'by_instance' ? group.instance || 'unidentified' : '';
+                const label = [group.server, group.protocol ? group.protocol.toUpperCase() : '', group.domain, instance]
+                    .filter(part => part).join(' / ');
+                html += '<tr>' +
+                    '<td>' + escapeHtml(label) + '</td>' +
+                    '<td>' + group.total_queries + '</td>' +
+                    '<td>' + group.successful + '</td>' +
+                    '<td>' + group.failed + '</td>' +
+                    '<td>' + ms(group, group.average_time) + '</td>' +
+                    '<td>' + ms(group, group.min_time) + '</td>' +
+                    '<td>' + ms(group, group.max_time) + '</td>' +
+                    '<td>' + ms(group, group.p50_time) + '</td>' +
+                    '<td>' + ms(group, group.p90_time) + '</td>' +
+                    '<td>' + ms(group, group.p95_time) + '</td>' +
+                    '<td>' + ms(group, group.p99_time) + '</td>' +
+                    '<td>' + ms(group, group.stddev_time) + '</td>' +
+                '</tr>';
+            });
+            html += '</tbody></table>';
+            breakdownTable.innerHTML = html;
+        }
+
+        function displayConsistency(groups) {
+            const consistencyTable = document.getElementById('consistencyTable');
+            if (groups.length === 0) {
+                consistencyTable.innerHTML = '';
+                return;
+            }
+
+            let html = '<h2 style="margin-top: 30px;">Answer Consistency</h2>' +
+                '<table class="results-table"><thead><tr><th>Domain</th><th>Type</th><th>Status</th><th>Server</th><th>Protocol</th><th>Answers</th></tr></thead><tbody>';
+            groups.forEach(group => {
+                const divergent = group.entries.filter(e => e.diverges);
+                const status = group.consistent ?
+                    '<span class="status-success">✓ ' + group.entries.length + ' agree</span>' :
+                    '<span class="status-failed">✗ ' + divergent.length + ' of ' + group.entries.length + ' diverge</span>';
+                const reference = group.reference === 'majority' ?
+                    '(majority of ' + group.entries.length + ')' : group.reference;
+                html += '<tr>' +
+                    '<td>' + escapeHtml(group.domain) + '</td>' +
+                    '<td>' + escapeHtml(group.query_type) + '</td>' +
+                    '<td>' + status + '</td>' +
+                    '<td>' + escapeHtml(reference) + '</td>' +
+                    '<td>-</td>' +
+                    '<td>' + escapeHtml(group.expected) + '</td>' +
+                '</tr>';
+                divergent.forEach(entry => {
+                    html += '<tr>' +
+                        '<td></td><td></td>' +
+                        '<td><span class="status-failed">✗ diverges</span></td>' +
+                        '<td>' + escapeHtml(entry.server_name) + '</td>' +
+                        '<td>' + escapeHtml(entry.protocol.toUpperCase()) + '</td>' +
+                        '<td>' + escapeHtml(entry.answer_set) + '</td>' +
+                    '</tr>';
+                });
+            });
+            html += '</tbody></table>';
+            consistencyTable.innerHTML = html;
+        }
+
+        function formatTiming(timing) {
+            if (!timing) {
+                return '';
+            }
+            const phases = [
+                ['DNS', timing.dns_lookup],
+                ['connect', timing.connect],
+                ['TLS', timing.tls_handshake],
+                ['HTTP', timing.http],
+                ['exchange', timing.exchange]
+            ].filter(phase => phase[1] > 0).map(phase => phase[0] + ' ' + phase[1].toFixed(3));
+            return phases.length > 0 ? '<br><small>' + phases.join(', ') + '</small>' : '';
+        }
+
+        function formatAnswer(answer) {
+            return answer.type + ' ' + answer.data + ' (' + answer.ttl + 's)';
+        }
+
+        function formatExtendedError(ede) {
+            return 'EDE ' + ede.info_code + (ede.name ? ' (' + ede.name + ')' : '') +
+                (ede.extra_text ? ': ' + ede.extra_text : '');
+        }
+
         function escapeHtml(text) {
             const div = document.createElement('div');
             div.textContent = text;
@@ -570,93 +1100,92 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 
 // TestRequest represents the request body for running tests
 type TestRequest struct {
-	Domains []string      `json:"domains"`
-	Servers []types.Server `json:"servers"`
-}
+	Domains      []types.Domain `json:"domains"`
+	QueryTypes   []string       `json:"query_types"`
+	Servers      []types.Server `json:"servers"`
+	Timeout      types.Duration `json:"timeout"`
+	Retries      int            `json:"retries"`
+	RetryBackoff types.Duration `json:"retry_backoff"`
 
-// handleTest handles POST requests to /api/test. Accepts JSON with domains and servers, runs DNS queries
-// synchronously, and returns results as JSON. Uses encoding/json for request/response handling.
-func handleTest(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	DNSSEC *types.DNSSECOptions `json:"dnssec"`
+	EDNS   *types.EDNSOptions   `json:"edns"`
 
-	var req TestRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
-		return
-	}
+	// Reference is the server name answers are compared against; empty compares against the majority
+	Reference string `json:"reference"`
+}
 
-	// Validate request
+// config validates the request as a configuration file is validated and builds the test
+// configuration, with defaults applied.
+func (req TestRequest) config() (*types.Config, error) {
 	if len(req.Domains) == 0 {
-		http.Error(w, "At least one domain is required", http.StatusBadRequest)
-		return
+		return nil, fmt.Errorf("At least one domain is required")
 	}
 	if len(req.Servers) == 0 {
-		http.Error(w, "At least one server is required", http.StatusBadRequest)
-		return
-	}
-
-	// Run tests
-	var results []types.QueryResult
-	for _, server := range req.Servers {
-		for _, domain := range req.Domains {
-			for _, protocol := range server.Protocols {
-				result := dns.QueryDNS(server, domain, protocol)
-				results = append(results, result)
-			}
-		}
+		return nil, fmt.Errorf("At least one server is required")
 	}
 
-	// Generate summary
-	summary := report.CalculateSummary(results)
-
-	// Prepare response
-	response := map[string]interface{}{
-		"results": convertResults(results),
-		"summary": convertSummary(summary),
+	cfg := &types.Config{
+		Domains:      req.Domains,
+		QueryTypes:   req.QueryTypes,
+		Servers:      req.Servers,
+		Timeout:      req.Timeout,
+		Retries:      req.Retries,
+		RetryBackoff: req.RetryBackoff,
+		DNSSEC:       req.DNSSEC,
+		EDNS:         req.EDNS,
+		Consistency:  types.ConsistencyOptions{Reference: req.Reference},
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
-		return
+	if err := config.Validate(cfg); err != nil {
+		return nil, fmt.Errorf("Invalid configuration: %w", err)
 	}
+	config.ApplyDefaults(cfg)
+	return cfg, nil
 }
 
-// handleReport handles report generation (for future use)
-func handleReport(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "Not implemented", http.StatusNotImplemented)
-}
+// handleTest handles POST requests to /api/test. Accepts JSON with domains and servers, runs DNS queries
+// concurrently via the runner package, and returns results as JSON once all have completed. Completed
+// runs are saved to the history, if enabled. Large test matrices should use the asynchronous job API
+// (see jobs.go) instead.
+// Uses encoding/json for request/response handling.
+func handleTest(store *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-// convertResults converts QueryResult slices to snake_case JSON format for API responses.
-func convertResults(results []types.QueryResult) []map[string]interface{} {
-	converted := make([]map[string]interface{}, len(results))
-	for i, r := range results {
-		converted[i] = map[string]interface{}{
-			"server_name":    r.ServerName,
-			"server_address": r.ServerAddress,
-			"domain":         r.Domain,
-			"protocol":       r.Protocol,
-			"response_ips":   r.ResponseIPs,
-			"response_time":  r.ResponseTime,
-			"success":        r.Success,
-			"error":          r.Error,
+		var req TestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
 		}
-	}
-	return converted
-}
+		cfg, err := req.config()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Run tests
+		started := time.Now()
+		jobs := runner.Plan(cfg)
+		results := runner.Run(r.Context(), jobs, runner.Options{})
 
-// convertSummary converts Summary to snake_case JSON format for API responses.
-func convertSummary(summary types.Summary) map[string]interface{} {
-	return map[string]interface{}{
-		"total_queries": summary.TotalQueries,
-		"successful":    summary.Successful,
-		"failed":        summary.Failed,
-		"average_time":  summary.AverageTime,
-		"min_time":      summary.MinTime,
-		"max_time":      summary.MaxTime,
+		// Prepare response; field names come from the JSON tags shared with the CLI json report
+		response := types.Report{
+			Results:     results,
+			Summary:     report.CalculateSummary(results),
+			Consistency: report.AnalyzeConsistency(results, req.Reference),
+		}
+		if r.Context().Err() == nil {
+			if id, err := newID(); err == nil {
+				saveRun(store, id, JobCompleted, started, req, response)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+			return
+		}
 	}
 }
-
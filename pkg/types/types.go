@@ -1,43 +1,552 @@
 package types
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
 // Config represents the root configuration structure
 type Config struct {
-	Domains  []string  `yaml:"domains"`
-	Servers []Server `yaml:"servers"`
+	Domains     []Domain `yaml:"domains"`
+	QueryTypes  []string `yaml:"query_types"`
+	Concurrency int      `yaml:"concurrency"` // maximum queries in flight overall
+	Servers     []Server `yaml:"servers"`
+
+	// Defaults for servers that do not set their own
+	Timeout      Duration `yaml:"timeout"`       // per attempt
+	Retries      int      `yaml:"retries"`       // additional attempts after a transport error
+	RetryBackoff Duration `yaml:"retry_backoff"` // delay before the first retry, doubled for each further retry
+
+	DNSSEC *DNSSECOptions `yaml:"dnssec"`
+	EDNS   *EDNSOptions   `yaml:"edns"`
+
+	Consistency ConsistencyOptions `yaml:"consistency"`
+
+	Monitor MonitorOptions `yaml:"monitor"`
+}
+
+// ConsistencyOptions configures the cross-server answer comparison in reports
+type ConsistencyOptions struct {
+	Reference string `yaml:"reference"` // server name to compare against; default: the majority answer
+}
+
+// MonitorOptions configures monitor mode, which re-runs the test matrix on a schedule
+type MonitorOptions struct {
+	Interval          Duration `yaml:"interval"`           // time between runs; servers may override it
+	Window            int      `yaml:"window"`             // number of recent checks kept per target for rolling statistics
+	FailureThreshold  int      `yaml:"failure_threshold"`  // consecutive failed checks before a target is down
+	RecoveryThreshold int      `yaml:"recovery_threshold"` // consecutive passed checks before a down target is up
+	EventsFile        string   `yaml:"events_file"`        // append state change events to this file as NDJSON
 }
 
 // Server represents a DNS server configuration
 type Server struct {
-	Name      string   `yaml:"name"`
-	Address   string   `yaml:"address"`
-	Protocols []string `yaml:"protocols"`
+	Name       string   `yaml:"name" json:"name"`
+	Address    string   `yaml:"address" json:"address"`
+	Protocols  []string `yaml:"protocols" json:"protocols"`
+	QueryTypes []string `yaml:"query_types,omitempty" json:"query_types,omitempty"`
+
+	// MaxConcurrency limits queries in flight to this server; 0 means only the global limit applies
+	MaxConcurrency int `yaml:"max_concurrency,omitempty" json:"max_concurrency,omitempty"`
+
+	// Timeout, retry and backoff settings; unset values inherit the global configuration
+	Timeout      Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Retries      *int     `yaml:"retries,omitempty" json:"retries,omitempty"`
+	RetryBackoff Duration `yaml:"retry_backoff,omitempty" json:"retry_backoff,omitempty"`
+
+	// TLS settings for dot, doq and doh (doh uses the URL host as the default server name)
+	TLSServerName         string `yaml:"tls_server_name,omitempty" json:"tls_server_name,omitempty"`
+	TLSInsecureSkipVerify bool   `yaml:"tls_insecure_skip_verify,omitempty" json:"tls_insecure_skip_verify,omitempty"`
+
+	DoH DoHOptions `yaml:"doh,omitempty" json:"doh,omitempty"`
+
+	// Interval overrides the monitor interval for this server
+	Interval Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+
+	// Critical servers fail the run on any failed query, whatever the failure policy
+	Critical bool `yaml:"critical,omitempty" json:"critical,omitempty"`
+
+	// DNSSEC is inherited from the global configuration when unset. When running queries it holds
+	// the effective options for the query, including any domain-level override.
+	DNSSEC *DNSSECOptions `yaml:"dnssec,omitempty" json:"dnssec,omitempty"`
+
+	// EDNS is inherited and overridden like DNSSEC
+	EDNS *EDNSOptions `yaml:"edns,omitempty" json:"edns,omitempty"`
+
+	// Identify records which instance of an anycast server answered each query, from the NSID of
+	// the response or, failing that, an id.server or hostname.bind CHAOS TXT query
+	Identify bool `yaml:"identify,omitempty" json:"identify,omitempty"`
+}
+
+// DNSSEC validation outcomes recorded in QueryResult.DNSSECStatus
+const (
+	DNSSECSecure        = "secure"        // every RRset validated up to a trust anchor
+	DNSSECInsecure      = "insecure"      // the answer is in a provably unsigned zone
+	DNSSECBogus         = "bogus"         // signatures are missing or do not validate
+	DNSSECIndeterminate = "indeterminate" // the chain of trust could not be followed
+)
+
+// DNSSECOptions configures the DNSSEC OK (DO) and Checking Disabled (CD) bits, and optional local
+// validation of responses up to a trust anchor.
+type DNSSECOptions struct {
+	DO           bool     `yaml:"do,omitempty" json:"do,omitempty"`
+	CD           bool     `yaml:"cd,omitempty" json:"cd,omitempty"`
+	Validate     bool     `yaml:"validate,omitempty" json:"validate,omitempty"`           // implies do
+	TrustAnchors []string `yaml:"trust_anchors,omitempty" json:"trust_anchors,omitempty"` // DS or DNSKEY records; default: root KSKs
+}
+
+// Outcomes of the EDNS checks recorded in QueryResult.CookieStatus and QueryResult.PaddingStatus
+const (
+	CookieValid     = "valid"     // the client cookie was echoed with a well-formed server cookie
+	CookieMissing   = "missing"   // the response carried no cookie
+	CookieMismatch  = "mismatch"  // the response echoed a different client cookie
+	CookieMalformed = "malformed" // the server cookie is not 8 to 32 bytes long
+
+	Padded   = "padded"   // the response carried a padding option
+	Unpadded = "unpadded" // the response was not padded
+)
+
+// Sources of the instance identifier recorded in QueryResult.InstanceSource
+const (
+	InstanceNSID         = "nsid"          // the NSID option of the response
+	InstanceIDServer     = "id.server"     // a CHAOS TXT query for id.server
+	InstanceHostnameBind = "hostname.bind" // a CHAOS TXT query for hostname.bind
+	InstanceUnidentified = "none"          // the server did not identify itself
+)
+
+// EDNSOptions configures the EDNS(0) OPT record sent with queries. Queries carry an OPT record when
+// EDNS options are set, even if empty, or when the DNSSEC options need one.
+type EDNSOptions struct {
+	UDPSize      uint16 `yaml:"udp_size,omitempty" json:"udp_size,omitempty"`           // advertised UDP payload size; default 4096
+	ClientSubnet string `yaml:"client_subnet,omitempty" json:"client_subnet,omitempty"` // EDNS Client Subnet (RFC 7871) prefix, e.g. 198.51.100.0/24
+	Cookie       bool   `yaml:"cookie,omitempty" json:"cookie,omitempty"`               // send a client cookie (RFC 7873) and verify the server cookie
+	NSID         bool   `yaml:"nsid,omitempty" json:"nsid,omitempty"`                   // request the name server identifier (RFC 5001)
+	Padding      bool   `yaml:"padding,omitempty" json:"padding,omitempty"`             // pad queries (RFC 7830) and check that dot, doh and doq responses are padded
+}
+
+// DoH request methods, HTTP versions and message formats accepted in DoHOptions
+const (
+	DoHMethodPost = "post"
+	DoHMethodGet  = "get"
+
+	HTTPVersion1 = "1.1"
+	HTTPVersion2 = "2"
+
+	DoHFormatWire = "wire"
+	DoHFormatJSON = "json"
+)
+
+// DoHOptions configures how DoH queries are sent. Empty fields use the defaults: binary POST,
+// negotiated HTTP version, and wire format (JSON for /resolve URLs).
+type DoHOptions struct {
+	Method      string `yaml:"method,omitempty" json:"method,omitempty"`             // post or get (RFC 8484 dns= parameter)
+	HTTPVersion string `yaml:"http_version,omitempty" json:"http_version,omitempty"` // 1.1 or 2
+	Format      string `yaml:"format,omitempty" json:"format,omitempty"`             // wire (application/dns-message) or json (application/dns-json)
+}
+
+// Domain represents a domain to test. It may be written as a plain string or as a
+// mapping with per-domain settings such as query types.
+type Domain struct {
+	Name       string         `yaml:"name" json:"name"`
+	QueryTypes []string       `yaml:"query_types,omitempty" json:"query_types,omitempty"`
+	DNSSEC     *DNSSECOptions `yaml:"dnssec,omitempty" json:"dnssec,omitempty"` // overrides the server's options
+	EDNS       *EDNSOptions   `yaml:"edns,omitempty" json:"edns,omitempty"`     // overrides the server's options
+	Expect     *Expectation   `yaml:"expect,omitempty" json:"expect,omitempty"`
+}
+
+// Expectation describes the answers a domain must return. Unset fields are not checked; the rcode
+// defaults to NOERROR. Address checks apply to A/AAAA queries and the TXT regex to TXT queries.
+type Expectation struct {
+	IPs      []string `yaml:"ips,omitempty" json:"ips,omitempty"`             // exact set of addresses of the queried family
+	CIDRs    []string `yaml:"cidrs,omitempty" json:"cidrs,omitempty"`         // every address must be within one of these
+	Rcode    string   `yaml:"rcode,omitempty" json:"rcode,omitempty"`         // e.g. NOERROR, NXDOMAIN
+	MinTTL   *uint32  `yaml:"min_ttl,omitempty" json:"min_ttl,omitempty"`     // every answer TTL must be at least this
+	MaxTTL   *uint32  `yaml:"max_ttl,omitempty" json:"max_ttl,omitempty"`     // every answer TTL must be at most this
+	CNAME    string   `yaml:"cname,omitempty" json:"cname,omitempty"`         // expected CNAME target
+	TXTRegex string   `yaml:"txt_regex,omitempty" json:"txt_regex,omitempty"` // at least one TXT record must match
+}
+
+// AssertionResult is the outcome of checking a result against a domain's Expectation
+type AssertionResult struct {
+	Passed   bool     `json:"passed"`
+	Failures []string `json:"failures"`
+}
+
+// domainFields is Domain without its custom unmarshalers, used to decode the mapping form.
+type domainFields Domain
+
+// UnmarshalYAML accepts either a scalar domain name or a mapping.
+func (d *Domain) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*d = Domain{Name: value.Value}
+		return nil
+	}
+	return value.Decode((*domainFields)(d))
+}
+
+// UnmarshalJSON accepts either a string domain name or an object.
+func (d *Domain) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*d = Domain{Name: name}
+		return nil
+	}
+	return json.Unmarshal(data, (*domainFields)(d))
+}
+
+// Duration is a time.Duration written as a string such as "2s" or "500ms" in YAML and JSON.
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("invalid duration '%s': %w", value.Value, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML writes the duration as a string.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// UnmarshalJSON parses a duration string, or a number of nanoseconds as encoded for time.Duration.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		var nanoseconds int64
+		if err := json.Unmarshal(data, &nanoseconds); err != nil {
+			return fmt.Errorf("invalid duration %s", data)
+		}
+		*d = Duration(nanoseconds)
+		return nil
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return fmt.Errorf("invalid duration '%s': %w", text, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// The JSON field names below are shared by the CLI json/ndjson reports and the HTTP API, and are
+// part of their documented output format.
+
+// Answer represents a single resource record from a response section
+type Answer struct {
+	Name string `json:"name"` // owner name
+	Type string `json:"type"`
+	TTL  uint32 `json:"ttl"`
+	Data string `json:"data"` // presentation-format rdata
 }
 
 // QueryResult represents the result of a DNS query
 type QueryResult struct {
-	ServerName    string
-	ServerAddress string
-	Domain        string
-	Protocol      string
-	ResponseIPs   []string
-	ResponseTime  int64 // milliseconds
-	Success       bool
-	Error         string
+	ServerName    string           `json:"server_name"`
+	ServerAddress string           `json:"server_address"`
+	Domain        string           `json:"domain"`
+	QueryType     string           `json:"query_type"`
+	Protocol      string           `json:"protocol"`
+	Answers       []Answer         `json:"answers"`
+	ResponseIPs   []string         `json:"response_ips"`   // A and AAAA rdata from Answers
+	Rcode         string           `json:"rcode"`          // response code name, e.g. NOERROR or NXDOMAIN; "" if no response was received
+	ResponseTime  float64          `json:"response_time"`  // milliseconds, with microsecond precision
+	Timing        Timing           `json:"timing"`         // ResponseTime broken down by phase
+	HTTPVersion   string           `json:"http_version"`   // negotiated HTTP protocol for doh, e.g. "HTTP/2.0"
+	HTTPStatus    int              `json:"http_status"`    // HTTP status code for doh, 0 if no response was received
+	Flags         Flags            `json:"flags"`          // header flags of the response
+	Authority     []Answer         `json:"authority"`      // authority section records
+	Additional    []Answer         `json:"additional"`     // additional section records, without the EDNS OPT record
+	ResponseSize  int              `json:"response_size"`  // response message size in bytes as received; for the DoH JSON API, of the equivalent wire message
+	EDNS          *EDNS            `json:"edns"`           // EDNS(0) OPT record of the response, nil if it had none
+	CookieStatus  string           `json:"cookie_status"`  // with edns cookie: valid, missing, mismatch or malformed; "" if not checked
+	PaddingStatus string           `json:"padding_status"` // with edns padding over dot, doh or doq: padded or unpadded; "" if not checked
+	DNSSECStatus  string           `json:"dnssec_status"`  // local validation outcome (secure, insecure, bogus, indeterminate), "" if not validated
+	DNSSECReason  string           `json:"dnssec_reason"`  // why the status is not secure
+	Success       bool             `json:"success"`
+	Error         string           `json:"error"`
+	Attempts      int              `json:"attempts"`       // number of attempts made, including the final one
+	AttemptErrors []string         `json:"attempt_errors"` // errors from failed attempts, in order
+	Assertion     *AssertionResult `json:"assertion"`      // nil when the domain has no expectations
+
+	// Server instance that answered, for servers with identify
+	Instance       string `json:"instance"`        // instance identifier, "" if unidentified
+	InstanceSource string `json:"instance_source"` // nsid, id.server, hostname.bind, or none if unidentified
+
+	// Extended DNS Errors (RFC 8914) returned in the response's OPT record, in order
+	ExtendedErrors []ExtendedError `json:"extended_errors"`
+}
+
+// ExtendedError is an Extended DNS Error option of a response, explaining an error rcode or
+// qualifying an answer, e.g. as stale or filtered
+type ExtendedError struct {
+	InfoCode  uint16 `json:"info_code"`
+	Name      string `json:"name"`       // e.g. "DNSSEC Bogus" or "Blocked"; "" for unassigned codes
+	ExtraText string `json:"extra_text"` // optional text from the server
+}
+
+// String renders an extended error as "EDE 6 (DNSSEC Bogus): extra text".
+func (e ExtendedError) String() string {
+	s := fmt.Sprintf("EDE %d", e.InfoCode)
+	if e.Name != "" {
+		s += " (" + e.Name + ")"
+	}
+	if e.ExtraText != "" {
+		s += ": " + e.ExtraText
+	}
+	return s
+}
+
+// Flags are the header flags of a response
+type Flags struct {
+	AA bool `json:"aa"` // Authoritative Answer
+	TC bool `json:"tc"` // Truncated
+	RD bool `json:"rd"` // Recursion Desired
+	RA bool `json:"ra"` // Recursion Available
+	AD bool `json:"ad"` // Authenticated Data
+	CD bool `json:"cd"` // Checking Disabled
+}
+
+// EDNS describes the EDNS(0) OPT record of a response
+type EDNS struct {
+	Version uint8  `json:"version"`
+	UDPSize uint16 `json:"udp_size"` // UDP payload size advertised by the server
+	DO      bool   `json:"do"`       // DNSSEC OK
+
+	Options      []EDNSOption `json:"options"`                 // every option returned, in order
+	NSID         string       `json:"nsid,omitempty"`          // name server identifier, as text when printable and hex otherwise
+	ClientSubnet string       `json:"client_subnet,omitempty"` // returned client subnet as address/source prefix/scope prefix
+	ServerCookie string       `json:"server_cookie,omitempty"` // server cookie, hex encoded
+	Padding      int          `json:"padding,omitempty"`       // length of the padding option in bytes
+}
+
+// EDNSOption is an option of a response's OPT record
+type EDNSOption struct {
+	Code uint16 `json:"code"`
+	Name string `json:"name"` // e.g. NSID, ECS, COOKIE, PADDING or EDE; OPTn for unknown codes
+	Data string `json:"data"` // presentation format
+}
+
+// Timing breaks down the response time of a query's final attempt into phases, in milliseconds with
+// microsecond precision. Phases the transport does not go through, or that were skipped by reusing a
+// connection, are 0.
+type Timing struct {
+	DNSLookup    float64 `json:"dns_lookup"`    // resolving the server hostname
+	Connect      float64 `json:"connect"`       // TCP connect (tcp, dot, doh)
+	TLSHandshake float64 `json:"tls_handshake"` // TLS handshake (dot, doh) or QUIC handshake (doq)
+	HTTP         float64 `json:"http"`          // HTTP request and response (doh)
+	Exchange     float64 `json:"exchange"`      // DNS message exchange on the connection (udp, tcp, dot, doq)
+}
+
+// Retried reports whether the query succeeded only after one or more failed attempts.
+func (r QueryResult) Retried() bool {
+	return r.Success && r.Attempts > 1
+}
+
+// Passed reports whether the query met its domain's expectations, or succeeded if there are none. A
+// query expected to return an error rcode such as NXDOMAIN passes without succeeding.
+func (r QueryResult) Passed() bool {
+	if r.Assertion != nil {
+		return r.Assertion.Passed
+	}
+	return r.Success
 }
 
 // Report represents the complete test report
 type Report struct {
-	Results []QueryResult
-	Summary Summary
+	Results     []QueryResult      `json:"results"`
+	Summary     Summary            `json:"summary"`
+	Consistency []ConsistencyGroup `json:"consistency"`
+}
+
+// ConsistencyGroup compares the answer sets that servers returned for one domain and query type
+type ConsistencyGroup struct {
+	Domain     string             `json:"domain"`
+	QueryType  string             `json:"query_type"`
+	Reference  string             `json:"reference"` // reference server name, or "majority"
+	Expected   string             `json:"expected"`  // answer set the entries are compared against
+	Consistent bool               `json:"consistent"`
+	Entries    []ConsistencyEntry `json:"entries"`
+}
+
+// ConsistencyEntry is one server/protocol's answer set within a ConsistencyGroup
+type ConsistencyEntry struct {
+	ServerName string `json:"server_name"`
+	Protocol   string `json:"protocol"`
+	AnswerSet  string `json:"answer_set"`
+	Diverges   bool   `json:"diverges"`
 }
 
-// Summary contains aggregate statistics
+// Summary contains aggregate statistics. Timing statistics cover successful queries only and are in
+// milliseconds.
 type Summary struct {
-	TotalQueries   int
-	Successful     int
-	Failed         int
-	AverageTime    float64
-	MinTime        int64
-	MaxTime        int64
+	TotalQueries     int     `json:"total_queries"`
+	Successful       int     `json:"successful"`
+	Failed           int     `json:"failed"`
+	Retried          int     `json:"retried"` // successful queries that needed more than one attempt
+	AssertionsPassed int     `json:"assertions_passed"`
+	AssertionsFailed int     `json:"assertions_failed"`
+	AverageTime      float64 `json:"average_time"`
+	MinTime          float64 `json:"min_time"`
+	MaxTime          float64 `json:"max_time"`
+	P50Time          float64 `json:"p50_time"`
+	P90Time          float64 `json:"p90_time"`
+	P95Time          float64 `json:"p95_time"`
+	P99Time          float64 `json:"p99_time"`
+	StdDevTime       float64 `json:"stddev_time"` // population standard deviation
+
+	// Breakdowns of the same statistics, set only on the overall summary
+	ByServer         []GroupSummary `json:"by_server,omitempty"`
+	ByProtocol       []GroupSummary `json:"by_protocol,omitempty"`
+	ByDomain         []GroupSummary `json:"by_domain,omitempty"`
+	ByServerProtocol []GroupSummary `json:"by_server_protocol,omitempty"`
+	ByInstance       []GroupSummary `json:"by_instance,omitempty"` // results of servers with identify, by server and instance
+}
+
+// GroupSummary is the Summary of the results that share a server, protocol, domain or server
+// instance. Only the fields of the grouping dimension are set.
+type GroupSummary struct {
+	Server   string `json:"server,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Instance string `json:"instance,omitempty"` // "" for results whose instance was not identified
+	Summary
+}
+
+// LatencyStats summarizes a set of response times, in milliseconds
+type LatencyStats struct {
+	Average float64 `json:"average"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+	StdDev  float64 `json:"stddev"` // population standard deviation
+}
+
+// HistogramBucket counts the responses with a latency in [LowerBound, UpperBound) milliseconds. The last
+// bucket has no upper bound and leaves UpperBound 0.
+type HistogramBucket struct {
+	LowerBound float64 `json:"lower_bound"`
+	UpperBound float64 `json:"upper_bound,omitempty"`
+	Count      int     `json:"count"`
 }
 
+// BenchReport is the outcome of a benchmark run against one server over one protocol
+type BenchReport struct {
+	ServerName    string  `json:"server_name"`
+	ServerAddress string  `json:"server_address"`
+	Protocol      string  `json:"protocol"`
+	Clients       int     `json:"clients"`
+	TargetQPS     float64 `json:"target_qps"` // 0 when each client sends its next query as soon as the last completes
+	Duration      float64 `json:"duration"`   // seconds from the first query until the last response
+
+	Sent        int     `json:"sent"`
+	Responses   int     `json:"responses"` // replies received, with any rcode
+	Timeouts    int     `json:"timeouts"`
+	Errors      int     `json:"errors"` // failures other than timeouts, including failed connections
+	AchievedQPS float64 `json:"achieved_qps"`
+	TimeoutRate float64 `json:"timeout_rate"` // fraction of sent queries that timed out
+	FirstError  string  `json:"first_error,omitempty"`
+
+	// Connections opened during the run; fewer connections than queries means connections were
+	// reused. For doh this counts new pooled HTTP connections.
+	Connections int `json:"connections"`
+
+	Latency   LatencyStats      `json:"latency"` // over all responses
+	Histogram []HistogramBucket `json:"histogram"`
+	Rcodes    map[string]int    `json:"rcodes"`
+}
+
+// Monitor target states
+const (
+	StateUnknown = "unknown" // not checked yet, or fewer checks than the threshold
+	StateUp      = "up"
+	StateDown    = "down"
+)
+
+// MonitorTarget identifies one query that monitor mode checks repeatedly
+type MonitorTarget struct {
+	ServerName    string `json:"server_name"`
+	ServerAddress string `json:"server_address"`
+	Protocol      string `json:"protocol"`
+	Domain        string `json:"domain"`
+	QueryType     string `json:"query_type"`
+}
+
+// TargetStatus is the current state and rolling statistics of a monitor target
+type TargetStatus struct {
+	MonitorTarget
+	State               string       `json:"state"`
+	Since               time.Time    `json:"since"` // time of the last state change
+	Checks              int          `json:"checks"`
+	Failures            int          `json:"failures"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	Availability        float64      `json:"availability"` // fraction of checks in the window that passed
+	Latency             LatencyStats `json:"latency"`      // over the passed checks in the window
+	LastCheck           time.Time    `json:"last_check"`
+	LastError           string       `json:"last_error,omitempty"`
+}
+
+// MonitorEvent records a target's change of state
+type MonitorEvent struct {
+	MonitorTarget
+	Time  time.Time `json:"time"`
+	From  string    `json:"from"`
+	To    string    `json:"to"`
+	Error string    `json:"error,omitempty"` // why the last check failed, when going down
+}
+
+// Comparison change kinds
+const (
+	ChangeNewFailure = "new_failure"        // passed in the baseline, fails now
+	ChangeRecovered  = "recovered"          // failed in the baseline, passes now
+	ChangeAnswers    = "answers_changed"    // answer set (or error rcode) differs
+	ChangeLatency    = "latency_regression" // response time grew beyond the thresholds
+	ChangeAdded      = "added"              // only in the current report
+	ChangeRemoved    = "removed"            // only in the baseline report
+)
+
+// Comparison is the difference between a baseline report and a current report of the same tests
+type Comparison struct {
+	Baseline         string  `json:"baseline"`
+	Current          string  `json:"current"`
+	LatencyThreshold float64 `json:"latency_threshold"` // relative increase, e.g. 0.5 for +50%
+	LatencyMinDelta  float64 `json:"latency_min_delta"` // minimum increase in ms
+
+	Compared           int `json:"compared"` // queries present in both reports
+	NewFailures        int `json:"new_failures"`
+	Recovered          int `json:"recovered"`
+	AnswerChanges      int `json:"answer_changes"`
+	LatencyRegressions int `json:"latency_regressions"`
+	Added              int `json:"added"`
+	Removed            int `json:"removed"`
+	Regressions        int `json:"regressions"`
+
+	Changes []Change `json:"changes"`
+}
+
+// Change is one difference found by a comparison
+type Change struct {
+	Kind       string  `json:"kind"`
+	ServerName string  `json:"server_name"`
+	Protocol   string  `json:"protocol"`
+	Domain     string  `json:"domain"`
+	QueryType  string  `json:"query_type"`
+	Regression bool    `json:"regression"`
+	Before     string  `json:"before,omitempty"` // answer set or failure reason in the baseline
+	After      string  `json:"after,omitempty"`  // answer set or failure reason now
+	BeforeTime float64 `json:"before_time"`      // response times in ms
+	AfterTime  float64 `json:"after_time"`
+}